@@ -1,9 +1,6 @@
 package blocks
 
 import (
-	"math/rand"
-	"time"
-
 	"github.com/marioskogias/schedsim/engine"
 )
 
@@ -15,31 +12,73 @@ type genericGenerator struct {
 	engine.Actor
 	ServiceTime RandDist
 	WaitTime    RandDist
+	// stamped on every generated request
+	Name  string
+	QoS   int
+	Label string
+	limit *GenerateLimit
 }
 
 func (g *genericGenerator) GetGenericActor() *engine.Actor {
 	return &g.Actor
 }
 
+// SetGenerateLimit makes the generator count its requests towards l
+func (g *genericGenerator) SetGenerateLimit(l *GenerateLimit) {
+	g.limit = l
+}
+
+func (g *genericGenerator) newRequest() Request {
+	return g.newRequestWith(g.ServiceTime.GetRand())
+}
+
+// newRequestWith returns a new request of the given service time
+func (g *genericGenerator) newRequestWith(serviceTime float64) Request {
+	if g.limit != nil {
+		g.limit.generated()
+	}
+	req := NewRequest(g.GetTime(), serviceTime)
+	req.Generator = g.Name
+	req.QoS = g.QoS
+	req.Label = g.Label
+	return req
+}
+
+// RandGenerator sends every request to a random out queue
 type RandGenerator struct {
 	genericGenerator
 }
 
+func NewRandGenerator(waitTime, serviceTime RandDist) *RandGenerator {
+	g := &RandGenerator{}
+	g.ServiceTime = serviceTime
+	g.WaitTime = waitTime
+	return g
+}
+
 func (g *RandGenerator) Run() {
 	for {
-		req := NewRequest(g.ServiceTime.GetRand())
-		g.WriteOutQueueI(req, rand.Intn(g.OutQueueCount()))
+		req := g.newRequest()
+		g.WriteOutQueueI(req, g.Rand().Intn(g.OutQueueCount()))
 		g.Wait(g.WaitTime.GetRand())
 	}
 }
 
+// RRGenerator sends requests to its out queues in round robin
 type RRGenerator struct {
 	genericGenerator
 }
 
+func NewRRGenerator(waitTime, serviceTime RandDist) *RRGenerator {
+	g := &RRGenerator{}
+	g.ServiceTime = serviceTime
+	g.WaitTime = waitTime
+	return g
+}
+
 func (g *RRGenerator) Run() {
 	for count := 0; ; count++ {
-		req := NewRequest(g.ServiceTime.GetRand())
+		req := g.newRequest()
 		g.WriteOutQueueI(req, count%g.OutQueueCount())
 		g.Wait(g.WaitTime.GetRand())
 	}
@@ -62,13 +101,10 @@ type MDGenerator struct {
 	RRGenerator
 }
 
-func NewMDGenerator(waitLambda float64, serviceTime float64) *MDGenerator {
-	// Seed with time
-	rand.Seed(time.Now().UTC().UnixNano())
-
+func NewMDGenerator(sim *engine.Simulation, waitLambda float64, serviceTime float64) *MDGenerator {
 	g := &MDGenerator{}
 	g.ServiceTime = NewDeterministicDistr(serviceTime)
-	g.WaitTime = NewExponDistr(waitLambda)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
 	return g
 }
 
@@ -76,12 +112,9 @@ type MDRandGenerator struct {
 	RandGenerator
 }
 
-func NewMDRandGenerator(waitLambda float64, serviceTime float64) *MDRandGenerator {
-	// Seed with time
-	rand.Seed(time.Now().UTC().UnixNano())
-
+func NewMDRandGenerator(sim *engine.Simulation, waitLambda float64, serviceTime float64) *MDRandGenerator {
 	g := &MDRandGenerator{}
-	g.ServiceTime = NewExponDistr(waitLambda)
+	g.ServiceTime = NewExponDistr(sim.NewRand(), waitLambda)
 	g.WaitTime = NewDeterministicDistr(serviceTime)
 	return g
 }
@@ -91,13 +124,10 @@ type MMGenerator struct {
 	RRGenerator
 }
 
-func NewMMGenerator(waitLambda float64, serviceMu float64) *MMGenerator {
-	// Seed with time
-	rand.Seed(time.Now().UTC().UnixNano())
-
+func NewMMGenerator(sim *engine.Simulation, waitLambda float64, serviceMu float64) *MMGenerator {
 	g := &MMGenerator{}
-	g.ServiceTime = NewExponDistr(serviceMu)
-	g.WaitTime = NewExponDistr(waitLambda)
+	g.ServiceTime = NewExponDistr(sim.NewRand(), serviceMu)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
 	return g
 }
 
@@ -106,13 +136,10 @@ type MMRandGenerator struct {
 	RandGenerator
 }
 
-func NewMMRandGenerator(waitLambda float64, serviceMu float64) *MMRandGenerator {
-	// Seed with time
-	rand.Seed(time.Now().UTC().UnixNano())
-
+func NewMMRandGenerator(sim *engine.Simulation, waitLambda float64, serviceMu float64) *MMRandGenerator {
 	g := &MMRandGenerator{}
-	g.ServiceTime = NewExponDistr(serviceMu)
-	g.WaitTime = NewExponDistr(waitLambda)
+	g.ServiceTime = NewExponDistr(sim.NewRand(), serviceMu)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
 	return g
 }
 
@@ -121,13 +148,10 @@ type MLNGenerator struct {
 	RRGenerator
 }
 
-func NewMLNGenerator(waitLambda, mu, sigma float64) *MLNGenerator {
-	// Seed with time
-	rand.Seed(time.Now().UTC().UnixNano())
-
+func NewMLNGenerator(sim *engine.Simulation, waitLambda, mu, sigma float64) *MLNGenerator {
 	g := &MLNGenerator{}
-	g.ServiceTime = NewLGDistr(mu, sigma)
-	g.WaitTime = NewExponDistr(waitLambda)
+	g.ServiceTime = NewLGDistr(sim.NewRand(), mu, sigma)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
 	return g
 }
 
@@ -137,12 +161,61 @@ type DBGenerator struct {
 	RRGenerator
 }
 
-func NewDBGenerator(waitLambda, peak1, peak2, ratio float64) *DBGenerator {
-	// Seed with time
-	rand.Seed(time.Now().UTC().UnixNano())
-
+func NewDBGenerator(sim *engine.Simulation, waitLambda, peak1, peak2, ratio float64) *DBGenerator {
 	g := &DBGenerator{}
-	g.ServiceTime = NewBiDistr(peak1, peak2, ratio)
-	g.WaitTime = NewExponDistr(waitLambda)
+	g.ServiceTime = NewBiDistr(sim.NewRand(), peak1, peak2, ratio)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
+	return g
+}
+
+// MParetoGenerator is a poisson interarrival generator with Pareto service
+// times of minimum xm and shape alpha
+type MParetoGenerator struct {
+	RRGenerator
+}
+
+func NewMParetoGenerator(sim *engine.Simulation, waitLambda, xm, alpha float64) *MParetoGenerator {
+	g := &MParetoGenerator{}
+	g.ServiceTime = NewParetoDistr(sim.NewRand(), xm, alpha)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
+	return g
+}
+
+// MBParetoGenerator is a poisson interarrival generator with bounded Pareto
+// service times
+type MBParetoGenerator struct {
+	RRGenerator
+}
+
+func NewMBParetoGenerator(sim *engine.Simulation, waitLambda, min, max, alpha float64) *MBParetoGenerator {
+	g := &MBParetoGenerator{}
+	g.ServiceTime = NewBoundedParetoDistr(sim.NewRand(), min, max, alpha)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
+	return g
+}
+
+// MWeibullGenerator is a poisson interarrival generator with Weibull service
+// times of shape k and scale lambda
+type MWeibullGenerator struct {
+	RRGenerator
+}
+
+func NewMWeibullGenerator(sim *engine.Simulation, waitLambda, k, lambda float64) *MWeibullGenerator {
+	g := &MWeibullGenerator{}
+	g.ServiceTime = NewWeibullDistr(sim.NewRand(), k, lambda)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
+	return g
+}
+
+// MGammaGenerator is a poisson interarrival generator with Gamma service
+// times of shape k and scale theta
+type MGammaGenerator struct {
+	RRGenerator
+}
+
+func NewMGammaGenerator(sim *engine.Simulation, waitLambda, k, theta float64) *MGammaGenerator {
+	g := &MGammaGenerator{}
+	g.ServiceTime = NewGammaDistr(sim.NewRand(), k, theta)
+	g.WaitTime = NewExponDistr(sim.NewRand(), waitLambda)
 	return g
 }
@@ -0,0 +1,120 @@
+package blocks
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// DropPolicy decides which element a full queue drops
+type DropPolicy int
+
+const (
+	// TailDrop drops the new element
+	TailDrop DropPolicy = iota
+	// HeadDrop drops the element that would be dequeued next and enqueues
+	// the new one
+	HeadDrop
+	// RandomEarlyDrop drops the new element with a probability that grows
+	// linearly from 0 to a maximum as the length goes from a threshold to the
+	// capacity, and always when the queue is full. It uses the instantaneous
+	// length rather than an average.
+	RandomEarlyDrop
+)
+
+var dropPolicyNames = []string{"tail", "head", "red"}
+
+func (p DropPolicy) String() string {
+	return dropPolicyNames[p]
+}
+
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	for i, n := range dropPolicyNames {
+		if n == s {
+			return DropPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown drop policy: %q", s)
+}
+
+// Bounded is implemented by the queues that can have a capacity
+type Bounded interface {
+	SetCapacity(capacity int, policy DropPolicy)
+	SetRED(rng *rand.Rand, threshold int, maxP float64)
+	SetDropDrain(rd RequestDrain)
+}
+
+type admission int
+
+const (
+	admit admission = iota
+	dropNew
+	dropHead
+)
+
+// bounded holds the capacity and the drop policy of a queue. A capacity of
+// 0 means the queue is unbounded.
+type bounded struct {
+	capacity  int
+	policy    DropPolicy
+	threshold int
+	maxP      float64
+	rng       *rand.Rand
+	dropDrain RequestDrain
+}
+
+// SetCapacity bounds the queue to capacity elements. Random early drop also
+// needs SetRED.
+func (b *bounded) SetCapacity(capacity int, policy DropPolicy) {
+	if capacity <= 0 {
+		panic(fmt.Sprintf("Wrong queue capacity: %v\n", capacity))
+	}
+	b.capacity = capacity
+	b.policy = policy
+}
+
+// SetRED sets the parameters of random early drop: the length where dropping
+// starts, the drop probability just below the capacity and the random stream
+// to draw from
+func (b *bounded) SetRED(rng *rand.Rand, threshold int, maxP float64) {
+	if threshold < 0 || maxP < 0 || maxP > 1 {
+		panic(fmt.Sprintf("Wrong random early drop: threshold=%v max_p=%v\n", threshold, maxP))
+	}
+	b.rng = rng
+	b.threshold = threshold
+	b.maxP = maxP
+}
+
+// SetDropDrain sets where dropped requests go. Without a drain they are
+// silently discarded.
+func (b *bounded) SetDropDrain(rd RequestDrain) {
+	b.dropDrain = rd
+}
+
+// admit decides what to do with a new element when the queue has l elements
+func (b *bounded) admit(l int) admission {
+	if b.capacity == 0 {
+		return admit
+	}
+	if l >= b.capacity {
+		if b.policy == HeadDrop {
+			return dropHead
+		}
+		return dropNew
+	}
+	if b.policy == RandomEarlyDrop && l >= b.threshold {
+		if b.rng == nil {
+			panic("Random early drop without SetRED\n")
+		}
+		p := b.maxP * float64(l-b.threshold) / float64(b.capacity-b.threshold)
+		if b.rng.Float64() < p {
+			return dropNew
+		}
+	}
+	return admit
+}
+
+func (b *bounded) drop(el interface{}) {
+	if r, ok := el.(Request); ok && b.dropDrain != nil {
+		b.dropDrain.TerminateReq(r)
+	}
+}
@@ -0,0 +1,65 @@
+package blocks
+
+import (
+	"math"
+)
+
+// t975 is the 0.975 quantile of the Student t distribution for 1 to 30
+// degrees of freedom
+var t975 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tQuantile975 returns the 0.975 quantile of the Student t distribution,
+// using the Cornish-Fisher expansion above 30 degrees of freedom
+func tQuantile975(df int) float64 {
+	if df <= 0 {
+		return math.Inf(1)
+	}
+	if df <= len(t975) {
+		return t975[df-1]
+	}
+	z := 1.959964
+	n := float64(df)
+	return z + (z*z*z+z)/(4*n) + (5*math.Pow(z, 5)+16*z*z*z+3*z)/(96*n*n)
+}
+
+// ConfidenceInterval returns the mean of independent, roughly normal
+// samples, e.g. replications or batch means, and the half width of its 95%
+// confidence interval. The half width is infinite for less than 2 samples.
+func ConfidenceInterval(xs []float64) (mean, halfWidth float64) {
+	if len(xs) == 0 {
+		return 0, math.Inf(1)
+	}
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	if len(xs) < 2 {
+		return mean, math.Inf(1)
+	}
+	var ss float64
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	stddev := math.Sqrt(ss / float64(len(xs)-1))
+	return mean, tQuantile975(len(xs)-1) * stddev / math.Sqrt(float64(len(xs)))
+}
+
+// Estimate is the mean of a value over Samples independent samples, e.g.
+// the batches of a run or the runs of a replication, and the half width of
+// its 95% confidence interval
+type Estimate struct {
+	Value     string  `json:"value"`
+	Mean      float64 `json:"mean"`
+	HalfWidth float64 `json:"ci95"`
+	Samples   int     `json:"samples"`
+}
+
+// NewEstimate estimates the mean of xs. It needs at least 2 samples.
+func NewEstimate(value string, xs []float64) Estimate {
+	mean, hw := ConfidenceInterval(xs)
+	return Estimate{Value: value, Mean: mean, HalfWidth: hw, Samples: len(xs)}
+}
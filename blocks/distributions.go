@@ -1,17 +1,54 @@
 package blocks
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 )
 
+// param is a named distribution parameter
+type param struct {
+	name string
+	v    float64
+}
+
+// checkPositive returns an error for the first parameter that is not
+// positive and finite
+func checkPositive(distr string, params ...param) error {
+	for _, p := range params {
+		if !(p.v > 0) || math.IsInf(p.v, 1) {
+			return fmt.Errorf("wrong %v %v: %v", distr, p.name, p.v)
+		}
+	}
+	return nil
+}
+
+// mustDistr panics with the error of a distribution constructor, if any
+func mustDistr(err error) {
+	if err != nil {
+		panic(fmt.Sprintf("%v\n", err))
+	}
+}
+
 // Deterministic Distribution
 type DeterministicDistr struct {
 	d float64
 }
 
 func NewDeterministicDistr(d float64) *DeterministicDistr {
-	return &DeterministicDistr{d}
+	distr, err := NewDeterministicDistrE(d)
+	mustDistr(err)
+	return distr
+}
+
+// NewDeterministicDistrE is NewDeterministicDistr returning an error instead
+// of panicking for a wrong value
+func NewDeterministicDistrE(d float64) (*DeterministicDistr, error) {
+	if err := checkPositive("deterministic", param{"value", d}); err != nil {
+		return nil, err
+	}
+	return &DeterministicDistr{d}, nil
 }
 
 func (distr *DeterministicDistr) GetRand() float64 {
@@ -20,47 +57,659 @@ func (distr *DeterministicDistr) GetRand() float64 {
 
 // Exponential Distribution
 type ExponDistr struct {
+	rng    *rand.Rand
 	lambda float64
 }
 
-func NewExponDistr(l float64) *ExponDistr {
-	return &ExponDistr{l}
+func NewExponDistr(rng *rand.Rand, l float64) *ExponDistr {
+	distr, err := NewExponDistrE(rng, l)
+	mustDistr(err)
+	return distr
+}
+
+// NewExponDistrE is NewExponDistr returning an error instead of panicking
+// for a wrong rate
+func NewExponDistrE(rng *rand.Rand, l float64) (*ExponDistr, error) {
+	if err := checkPositive("exponential", param{"rate", l}); err != nil {
+		return nil, err
+	}
+	return &ExponDistr{rng, l}, nil
 }
 
 func (distr *ExponDistr) GetRand() float64 {
-	return float64(rand.ExpFloat64() / distr.lambda)
+	return float64(distr.rng.ExpFloat64() / distr.lambda)
 }
 
 // LogNormal Distribution
 type LGDistr struct {
+	rng   *rand.Rand
 	mu    float64
 	sigma float64
 }
 
-func NewLGDistr(mu, sigma float64) *LGDistr {
-	return &LGDistr{mu, sigma}
+func NewLGDistr(rng *rand.Rand, mu, sigma float64) *LGDistr {
+	distr, err := NewLGDistrE(rng, mu, sigma)
+	mustDistr(err)
+	return distr
+}
+
+// NewLGDistrE is NewLGDistr returning an error instead of panicking for
+// wrong parameters
+func NewLGDistrE(rng *rand.Rand, mu, sigma float64) (*LGDistr, error) {
+	if math.IsNaN(mu) || math.IsInf(mu, 0) {
+		return nil, fmt.Errorf("wrong lognormal mu: %v", mu)
+	}
+	if err := checkPositive("lognormal", param{"sigma", sigma}); err != nil {
+		return nil, err
+	}
+	return &LGDistr{rng, mu, sigma}, nil
 }
 
 func (distr *LGDistr) GetRand() float64 {
-	z := rand.NormFloat64()
+	z := distr.rng.NormFloat64()
 	s := math.Exp(distr.mu + distr.sigma*z)
 	return s
 }
 
 // Bimodel Distribution
 type BiDistr struct {
+	rng   *rand.Rand
 	v1    float64
 	v2    float64
 	ratio float64
 }
 
-func NewBiDistr(v1, v2, ratio float64) *BiDistr {
-	return &BiDistr{v1, v2, ratio}
+func NewBiDistr(rng *rand.Rand, v1, v2, ratio float64) *BiDistr {
+	distr, err := NewBiDistrE(rng, v1, v2, ratio)
+	mustDistr(err)
+	return distr
+}
+
+// NewBiDistrE is NewBiDistr returning an error instead of panicking for
+// wrong parameters
+func NewBiDistrE(rng *rand.Rand, v1, v2, ratio float64) (*BiDistr, error) {
+	if err := checkPositive("bimodal", param{"v1", v1}, param{"v2", v2}); err != nil {
+		return nil, err
+	}
+	if !(ratio >= 0 && ratio <= 1) {
+		return nil, fmt.Errorf("wrong bimodal ratio: %v", ratio)
+	}
+	return &BiDistr{rng, v1, v2, ratio}, nil
 }
 
 func (distr *BiDistr) GetRand() float64 {
-	if rand.Float64() > distr.ratio {
+	if distr.rng.Float64() > distr.ratio {
 		return distr.v2
 	}
 	return distr.v1
 }
+
+// checkMeanSCV returns an error unless mean and scv, the squared
+// coefficient of variation, are positive
+func checkMeanSCV(name string, mean, scv float64) error {
+	return checkPositive(name, param{"mean", mean}, param{"scv", scv})
+}
+
+// bisect returns the x in [lo, hi] where the monotonic f reaches target, or
+// false if f does not reach it in [lo, hi]
+func bisect(f func(float64) float64, target, lo, hi float64) (float64, bool) {
+	flo, fhi := f(lo), f(hi)
+	if !(target >= math.Min(flo, fhi) && target <= math.Max(flo, fhi)) {
+		return 0, false
+	}
+	increasing := fhi > flo
+	for i := 0; i < 200 && hi-lo > 1e-12*hi; i++ {
+		mid := (lo + hi) / 2
+		if (f(mid) < target) == increasing {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2, true
+}
+
+// Pareto Distribution with scale xm, the minimum value, and shape alpha
+type ParetoDistr struct {
+	rng   *rand.Rand
+	xm    float64
+	alpha float64
+}
+
+func NewParetoDistr(rng *rand.Rand, xm, alpha float64) *ParetoDistr {
+	distr, err := NewParetoDistrE(rng, xm, alpha)
+	mustDistr(err)
+	return distr
+}
+
+// NewParetoDistrE is NewParetoDistr returning an error instead of panicking
+// for wrong parameters
+func NewParetoDistrE(rng *rand.Rand, xm, alpha float64) (*ParetoDistr, error) {
+	if err := checkPositive("pareto", param{"xm", xm}, param{"alpha", alpha}); err != nil {
+		return nil, err
+	}
+	return &ParetoDistr{rng, xm, alpha}, nil
+}
+
+// NewParetoDistrMeanSCV returns the Pareto distribution with the given mean
+// and squared coefficient of variation. The shape is then above 2.
+func NewParetoDistrMeanSCV(rng *rand.Rand, mean, scv float64) *ParetoDistr {
+	distr, err := NewParetoDistrMeanSCVE(rng, mean, scv)
+	mustDistr(err)
+	return distr
+}
+
+// NewParetoDistrMeanSCVE is NewParetoDistrMeanSCV returning an error instead
+// of panicking
+func NewParetoDistrMeanSCVE(rng *rand.Rand, mean, scv float64) (*ParetoDistr, error) {
+	if err := checkMeanSCV("pareto", mean, scv); err != nil {
+		return nil, err
+	}
+	alpha := 1 + math.Sqrt(1+1/scv)
+	return NewParetoDistrE(rng, mean*(alpha-1)/alpha, alpha)
+}
+
+func (distr *ParetoDistr) GetRand() float64 {
+	// 1-Float64() is in (0, 1]
+	return distr.xm / math.Pow(1-distr.rng.Float64(), 1/distr.alpha)
+}
+
+// Bounded Pareto Distribution with shape alpha between min and max
+type BoundedParetoDistr struct {
+	rng   *rand.Rand
+	min   float64
+	max   float64
+	alpha float64
+}
+
+func NewBoundedParetoDistr(rng *rand.Rand, min, max, alpha float64) *BoundedParetoDistr {
+	distr, err := NewBoundedParetoDistrE(rng, min, max, alpha)
+	mustDistr(err)
+	return distr
+}
+
+// NewBoundedParetoDistrE is NewBoundedParetoDistr returning an error instead
+// of panicking for wrong parameters
+func NewBoundedParetoDistrE(rng *rand.Rand, min, max, alpha float64) (*BoundedParetoDistr, error) {
+	if err := checkPositive("bounded pareto", param{"min", min}, param{"max", max}, param{"alpha", alpha}); err != nil {
+		return nil, err
+	}
+	if !(max > min) {
+		return nil, fmt.Errorf("bounded pareto max %v is not above min %v", max, min)
+	}
+	return &BoundedParetoDistr{rng, min, max, alpha}, nil
+}
+
+// boundedParetoMoment returns the k-th moment of the bounded Pareto
+// distribution
+func boundedParetoMoment(min, max, alpha float64, k float64) float64 {
+	c := alpha * math.Pow(min, alpha) / (1 - math.Pow(min/max, alpha))
+	if k == alpha {
+		return c * math.Log(max/min)
+	}
+	return c * (math.Pow(max, k-alpha) - math.Pow(min, k-alpha)) / (k - alpha)
+}
+
+// NewBoundedParetoDistrMeanSCV returns the bounded Pareto distribution with
+// shape alpha and the given mean and squared coefficient of variation. The
+// scv has to be below the one of the unbounded Pareto distribution with the
+// same shape, which is infinite for alpha <= 2.
+func NewBoundedParetoDistrMeanSCV(rng *rand.Rand, mean, scv, alpha float64) *BoundedParetoDistr {
+	distr, err := NewBoundedParetoDistrMeanSCVE(rng, mean, scv, alpha)
+	mustDistr(err)
+	return distr
+}
+
+// NewBoundedParetoDistrMeanSCVE is NewBoundedParetoDistrMeanSCV returning an
+// error instead of panicking
+func NewBoundedParetoDistrMeanSCVE(rng *rand.Rand, mean, scv, alpha float64) (*BoundedParetoDistr, error) {
+	if err := checkMeanSCV("bounded pareto", mean, scv); err != nil {
+		return nil, err
+	}
+	if err := checkPositive("bounded pareto", param{"alpha", alpha}); err != nil {
+		return nil, err
+	}
+	if alpha > 2 && scv >= 1/(alpha*(alpha-2)) {
+		return nil, fmt.Errorf("bounded pareto scv %v is not below %v for alpha %v", scv, 1/(alpha*(alpha-2)), alpha)
+	}
+	// the scv only depends on the ratio of max to min
+	scvOf := func(logRatio float64) float64 {
+		r := math.Exp(logRatio)
+		m := boundedParetoMoment(1, r, alpha, 1)
+		return boundedParetoMoment(1, r, alpha, 2)/(m*m) - 1
+	}
+	logRatio, ok := bisect(scvOf, scv, 1e-9, 700)
+	if !ok {
+		return nil, fmt.Errorf("bounded pareto scv %v cannot be reached for alpha %v", scv, alpha)
+	}
+	ratio := math.Exp(logRatio)
+	min := mean / boundedParetoMoment(1, ratio, alpha, 1)
+	return NewBoundedParetoDistrE(rng, min, min*ratio, alpha)
+}
+
+func (distr *BoundedParetoDistr) GetRand() float64 {
+	u := distr.rng.Float64()
+	return distr.min / math.Pow(1-u*(1-math.Pow(distr.min/distr.max, distr.alpha)), 1/distr.alpha)
+}
+
+// Weibull Distribution with shape k and scale lambda
+type WeibullDistr struct {
+	rng    *rand.Rand
+	k      float64
+	lambda float64
+}
+
+func NewWeibullDistr(rng *rand.Rand, k, lambda float64) *WeibullDistr {
+	distr, err := NewWeibullDistrE(rng, k, lambda)
+	mustDistr(err)
+	return distr
+}
+
+// NewWeibullDistrE is NewWeibullDistr returning an error instead of
+// panicking for wrong parameters
+func NewWeibullDistrE(rng *rand.Rand, k, lambda float64) (*WeibullDistr, error) {
+	if err := checkPositive("weibull", param{"shape", k}, param{"scale", lambda}); err != nil {
+		return nil, err
+	}
+	return &WeibullDistr{rng, k, lambda}, nil
+}
+
+// Shapes of the Weibull distributions fitted to a mean and scv
+const (
+	weibullMinShape = 0.01
+	weibullMaxShape = 1000
+)
+
+// NewWeibullDistrMeanSCV returns the Weibull distribution with the given
+// mean and squared coefficient of variation. The shape has to be between
+// weibullMinShape and weibullMaxShape, which bounds the scv.
+func NewWeibullDistrMeanSCV(rng *rand.Rand, mean, scv float64) *WeibullDistr {
+	distr, err := NewWeibullDistrMeanSCVE(rng, mean, scv)
+	mustDistr(err)
+	return distr
+}
+
+// NewWeibullDistrMeanSCVE is NewWeibullDistrMeanSCV returning an error
+// instead of panicking
+func NewWeibullDistrMeanSCVE(rng *rand.Rand, mean, scv float64) (*WeibullDistr, error) {
+	if err := checkMeanSCV("weibull", mean, scv); err != nil {
+		return nil, err
+	}
+	lgamma := func(x float64) float64 {
+		v, _ := math.Lgamma(x)
+		return v
+	}
+	// log(scv+1) is decreasing in the shape
+	logSCV1 := func(logK float64) float64 {
+		k := math.Exp(logK)
+		return lgamma(1+2/k) - 2*lgamma(1+1/k)
+	}
+	lo, hi := math.Log(weibullMinShape), math.Log(weibullMaxShape)
+	logK, ok := bisect(logSCV1, math.Log1p(scv), lo, hi)
+	if !ok {
+		return nil, fmt.Errorf("weibull scv %v is not between %v and %v", scv, math.Expm1(logSCV1(hi)), math.Expm1(logSCV1(lo)))
+	}
+	k := math.Exp(logK)
+	return NewWeibullDistrE(rng, k, mean/math.Exp(lgamma(1+1/k)))
+}
+
+func (distr *WeibullDistr) GetRand() float64 {
+	return distr.lambda * math.Pow(distr.rng.ExpFloat64(), 1/distr.k)
+}
+
+// Gamma Distribution with shape k and scale theta
+type GammaDistr struct {
+	rng   *rand.Rand
+	k     float64
+	theta float64
+}
+
+func NewGammaDistr(rng *rand.Rand, k, theta float64) *GammaDistr {
+	distr, err := NewGammaDistrE(rng, k, theta)
+	mustDistr(err)
+	return distr
+}
+
+// NewGammaDistrE is NewGammaDistr returning an error instead of panicking
+// for wrong parameters
+func NewGammaDistrE(rng *rand.Rand, k, theta float64) (*GammaDistr, error) {
+	if err := checkPositive("gamma", param{"shape", k}, param{"scale", theta}); err != nil {
+		return nil, err
+	}
+	return &GammaDistr{rng, k, theta}, nil
+}
+
+// NewGammaDistrMeanSCV returns the Gamma distribution with the given mean
+// and squared coefficient of variation
+func NewGammaDistrMeanSCV(rng *rand.Rand, mean, scv float64) *GammaDistr {
+	distr, err := NewGammaDistrMeanSCVE(rng, mean, scv)
+	mustDistr(err)
+	return distr
+}
+
+// NewGammaDistrMeanSCVE is NewGammaDistrMeanSCV returning an error instead
+// of panicking
+func NewGammaDistrMeanSCVE(rng *rand.Rand, mean, scv float64) (*GammaDistr, error) {
+	if err := checkMeanSCV("gamma", mean, scv); err != nil {
+		return nil, err
+	}
+	return NewGammaDistrE(rng, 1/scv, mean*scv)
+}
+
+// GetRand uses the method of Marsaglia and Tsang, boosting shapes below 1
+func (distr *GammaDistr) GetRand() float64 {
+	k, boost := distr.k, 1.0
+	if k < 1 {
+		boost = math.Pow(1-distr.rng.Float64(), 1/k)
+		k++
+	}
+	d := k - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := distr.rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := 1 - distr.rng.Float64()
+		if math.Log(u) < x*x/2+d-d*v+d*math.Log(v) {
+			return distr.theta * d * v * boost
+		}
+	}
+}
+
+// Erlang Distribution, the sum of k exponential phases of the same rate
+type ErlangDistr struct {
+	rng  *rand.Rand
+	k    int
+	rate float64
+}
+
+func NewErlangDistr(rng *rand.Rand, k int, rate float64) *ErlangDistr {
+	distr, err := NewErlangDistrE(rng, k, rate)
+	mustDistr(err)
+	return distr
+}
+
+// NewErlangDistrE is NewErlangDistr returning an error instead of panicking
+// for wrong parameters
+func NewErlangDistrE(rng *rand.Rand, k int, rate float64) (*ErlangDistr, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("wrong erlang k: %v", k)
+	}
+	if err := checkPositive("erlang", param{"rate", rate}); err != nil {
+		return nil, err
+	}
+	return &ErlangDistr{rng, k, rate}, nil
+}
+
+// NewErlangDistrMeanSCV returns the Erlang distribution with the given mean
+// and the number of phases whose squared coefficient of variation, 1/k, is
+// the closest to scv. Use a Coxian distribution to match any scv.
+func NewErlangDistrMeanSCV(rng *rand.Rand, mean, scv float64) *ErlangDistr {
+	distr, err := NewErlangDistrMeanSCVE(rng, mean, scv)
+	mustDistr(err)
+	return distr
+}
+
+// NewErlangDistrMeanSCVE is NewErlangDistrMeanSCV returning an error instead
+// of panicking
+func NewErlangDistrMeanSCVE(rng *rand.Rand, mean, scv float64) (*ErlangDistr, error) {
+	if err := checkMeanSCV("erlang", mean, scv); err != nil {
+		return nil, err
+	}
+	k := int(math.Max(1, math.Round(1/scv)))
+	return NewErlangDistrE(rng, k, float64(k)/mean)
+}
+
+func (distr *ErlangDistr) GetRand() float64 {
+	var s float64
+	for i := 0; i < distr.k; i++ {
+		s += distr.rng.ExpFloat64()
+	}
+	return s / distr.rate
+}
+
+// Hyperexponential Distribution, picking exponential phase i with
+// probability probs[i]
+type HyperExpDistr struct {
+	rng   *rand.Rand
+	probs []float64
+	rates []float64
+}
+
+func NewHyperExpDistr(rng *rand.Rand, probs, rates []float64) *HyperExpDistr {
+	distr, err := NewHyperExpDistrE(rng, probs, rates)
+	mustDistr(err)
+	return distr
+}
+
+// NewHyperExpDistrE is NewHyperExpDistr returning an error instead of
+// panicking for wrong parameters
+func NewHyperExpDistrE(rng *rand.Rand, probs, rates []float64) (*HyperExpDistr, error) {
+	if len(rates) == 0 || len(probs) != len(rates) {
+		return nil, fmt.Errorf("wrong hyperexponential phases: %v probabilities for %v rates", len(probs), len(rates))
+	}
+	var sum float64
+	for i, p := range probs {
+		if !(p >= 0 && p <= 1) {
+			return nil, fmt.Errorf("wrong hyperexponential probability %v: %v", i+1, p)
+		}
+		if err := checkPositive("hyperexponential", param{fmt.Sprintf("rate %v", i+1), rates[i]}); err != nil {
+			return nil, err
+		}
+		sum += p
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		return nil, fmt.Errorf("hyperexponential probabilities sum to %v instead of 1", sum)
+	}
+	return &HyperExpDistr{rng, probs, rates}, nil
+}
+
+// NewH2Distr returns the two phase hyperexponential distribution
+func NewH2Distr(rng *rand.Rand, p, rate1, rate2 float64) *HyperExpDistr {
+	return NewHyperExpDistr(rng, []float64{p, 1 - p}, []float64{rate1, rate2})
+}
+
+// NewH2DistrMeanSCV returns the two phase hyperexponential distribution with
+// balanced means, p1/rate1 = p2/rate2, and the given mean and squared
+// coefficient of variation. The scv has to be at least 1.
+func NewH2DistrMeanSCV(rng *rand.Rand, mean, scv float64) *HyperExpDistr {
+	distr, err := NewH2DistrMeanSCVE(rng, mean, scv)
+	mustDistr(err)
+	return distr
+}
+
+// NewH2DistrMeanSCVE is NewH2DistrMeanSCV returning an error instead of
+// panicking
+func NewH2DistrMeanSCVE(rng *rand.Rand, mean, scv float64) (*HyperExpDistr, error) {
+	if err := checkMeanSCV("hyperexponential", mean, scv); err != nil {
+		return nil, err
+	}
+	if scv < 1 {
+		return nil, fmt.Errorf("hyperexponential scv %v is below 1", scv)
+	}
+	p := (1 + math.Sqrt((scv-1)/(scv+1))) / 2
+	return NewHyperExpDistrE(rng, []float64{p, 1 - p}, []float64{2 * p / mean, 2 * (1 - p) / mean})
+}
+
+func (distr *HyperExpDistr) GetRand() float64 {
+	u := distr.rng.Float64()
+	i := 0
+	for ; i < len(distr.probs)-1; i++ {
+		if u < distr.probs[i] {
+			break
+		}
+		u -= distr.probs[i]
+	}
+	return distr.rng.ExpFloat64() / distr.rates[i]
+}
+
+// Coxian Distribution, a series of exponential phases. After phase i the
+// next phase follows with probability next[i] and there is no next phase
+// after the last one.
+type CoxianDistr struct {
+	rng   *rand.Rand
+	rates []float64
+	next  []float64
+}
+
+func NewCoxianDistr(rng *rand.Rand, rates, next []float64) *CoxianDistr {
+	distr, err := NewCoxianDistrE(rng, rates, next)
+	mustDistr(err)
+	return distr
+}
+
+// NewCoxianDistrE is NewCoxianDistr returning an error instead of panicking
+// for wrong parameters
+func NewCoxianDistrE(rng *rand.Rand, rates, next []float64) (*CoxianDistr, error) {
+	if len(rates) == 0 || len(next) != len(rates)-1 {
+		return nil, fmt.Errorf("wrong coxian phases: %v rates need %v next probabilities, not %v", len(rates), len(rates)-1, len(next))
+	}
+	for i, r := range rates {
+		if err := checkPositive("coxian", param{fmt.Sprintf("rate %v", i+1), r}); err != nil {
+			return nil, err
+		}
+	}
+	for i, p := range next {
+		if !(p >= 0 && p <= 1) {
+			return nil, fmt.Errorf("wrong coxian probability %v: %v", i+1, p)
+		}
+	}
+	return &CoxianDistr{rng, rates, next}, nil
+}
+
+// NewCoxianDistrMeanSCV returns a Coxian distribution with the given mean
+// and squared coefficient of variation. It has two phases for an scv of at
+// least 0.5, and is a mixture of Erlang k-1 and Erlang k distributions of
+// the same rate below, with k = ceil(1/scv).
+func NewCoxianDistrMeanSCV(rng *rand.Rand, mean, scv float64) *CoxianDistr {
+	distr, err := NewCoxianDistrMeanSCVE(rng, mean, scv)
+	mustDistr(err)
+	return distr
+}
+
+// NewCoxianDistrMeanSCVE is NewCoxianDistrMeanSCV returning an error instead
+// of panicking
+func NewCoxianDistrMeanSCVE(rng *rand.Rand, mean, scv float64) (*CoxianDistr, error) {
+	if err := checkMeanSCV("coxian", mean, scv); err != nil {
+		return nil, err
+	}
+	if scv >= 0.5 {
+		return NewCoxianDistrE(rng, []float64{2 / mean, 1 / (mean * scv)}, []float64{1 / (2 * scv)})
+	}
+	k := int(math.Ceil(1/scv - 1e-9))
+	kf := float64(k)
+	// Erlang k-1 with probability p, Erlang k otherwise
+	p := math.Max(0, (kf*scv-math.Sqrt(kf*(1+scv)-kf*kf*scv))/(1+scv))
+	rate := (kf - p) / mean
+	rates := make([]float64, k)
+	next := make([]float64, k-1)
+	for i := range rates {
+		rates[i] = rate
+	}
+	for i := range next {
+		next[i] = 1
+	}
+	next[k-2] = 1 - p
+	return NewCoxianDistrE(rng, rates, next)
+}
+
+func (distr *CoxianDistr) GetRand() float64 {
+	var s float64
+	for i, r := range distr.rates {
+		s += distr.rng.ExpFloat64() / r
+		if i == len(distr.next) || distr.rng.Float64() >= distr.next[i] {
+			break
+		}
+	}
+	return s
+}
+
+// pick returns the index i with a probability proportional to weight i,
+// given the cumulative sums of the weights
+func pick(rng *rand.Rand, cumulative []float64) int {
+	u := rng.Float64() * cumulative[len(cumulative)-1]
+	return sort.Search(len(cumulative)-1, func(i int) bool { return cumulative[i] > u })
+}
+
+// cumulate returns the cumulative sums of the weights, or an error if one of
+// them is negative or infinite or they are all 0
+func cumulate(name string, weights []float64) ([]float64, error) {
+	res := make([]float64, len(weights))
+	var sum float64
+	for i, w := range weights {
+		if !(w >= 0) || math.IsInf(w, 1) {
+			return nil, fmt.Errorf("wrong %v weight %v: %v", name, i+1, w)
+		}
+		sum += w
+		res[i] = sum
+	}
+	if !(sum > 0) || math.IsInf(sum, 1) {
+		return nil, fmt.Errorf("wrong %v weights: %v", name, weights)
+	}
+	return res, nil
+}
+
+// Mixture Distribution, drawing from component i with a probability
+// proportional to weights[i]
+type MixtureDistr struct {
+	rng        *rand.Rand
+	cumulative []float64
+	components []RandDist
+}
+
+func NewMixtureDistr(rng *rand.Rand, weights []float64, components []RandDist) *MixtureDistr {
+	distr, err := NewMixtureDistrE(rng, weights, components)
+	mustDistr(err)
+	return distr
+}
+
+// NewMixtureDistrE is NewMixtureDistr returning an error instead of
+// panicking for wrong weights
+func NewMixtureDistrE(rng *rand.Rand, weights []float64, components []RandDist) (*MixtureDistr, error) {
+	if len(weights) == 0 || len(weights) != len(components) {
+		return nil, fmt.Errorf("wrong mixture: %v weights for %v components", len(weights), len(components))
+	}
+	cumulative, err := cumulate("mixture", weights)
+	if err != nil {
+		return nil, err
+	}
+	return &MixtureDistr{rng, cumulative, components}, nil
+}
+
+func (distr *MixtureDistr) GetRand() float64 {
+	return distr.components[pick(distr.rng, distr.cumulative)].GetRand()
+}
+
+// Discrete Distribution, returning values[i] with a probability
+// proportional to weights[i]. It generalizes BiDistr to n values.
+type DiscreteDistr struct {
+	rng        *rand.Rand
+	values     []float64
+	cumulative []float64
+}
+
+func NewDiscreteDistr(rng *rand.Rand, values, weights []float64) *DiscreteDistr {
+	distr, err := NewDiscreteDistrE(rng, values, weights)
+	mustDistr(err)
+	return distr
+}
+
+// NewDiscreteDistrE is NewDiscreteDistr returning an error instead of
+// panicking for wrong weights
+func NewDiscreteDistrE(rng *rand.Rand, values, weights []float64) (*DiscreteDistr, error) {
+	if len(values) == 0 || len(weights) != len(values) {
+		return nil, fmt.Errorf("wrong discrete distribution: %v weights for %v values", len(weights), len(values))
+	}
+	cumulative, err := cumulate("discrete", weights)
+	if err != nil {
+		return nil, err
+	}
+	return &DiscreteDistr{rng, values, cumulative}, nil
+}
+
+func (distr *DiscreteDistr) GetRand() float64 {
+	return distr.values[pick(distr.rng, distr.cumulative)]
+}
@@ -0,0 +1,198 @@
+package blocks
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EmpiricalDistr samples observed values by inverting their cumulative
+// distribution function. The CDF is a step function through the points, or
+// with interpolation piecewise linear between them. Copies made by WithRand
+// share the points.
+type EmpiricalDistr struct {
+	rng         *rand.Rand
+	values      []float64
+	cdf         []float64
+	interpolate bool
+	mean        float64
+	variance    float64
+}
+
+// newEmpiricalDistr checks the points of a CDF and computes its moments
+func newEmpiricalDistr(rng *rand.Rand, values, cdf []float64, interpolate bool) (*EmpiricalDistr, error) {
+	if len(values) == 0 || len(values) != len(cdf) {
+		return nil, fmt.Errorf("empirical distribution needs a probability per value")
+	}
+	for i := range values {
+		if i > 0 && (values[i] < values[i-1] || cdf[i] < cdf[i-1]) {
+			return nil, fmt.Errorf("empirical distribution is not increasing at %v", values[i])
+		}
+		if cdf[i] < 0 {
+			return nil, fmt.Errorf("empirical distribution has a negative probability at %v", values[i])
+		}
+	}
+	if math.Abs(cdf[len(cdf)-1]-1) > 1e-9 {
+		return nil, fmt.Errorf("empirical distribution ends at probability %v instead of 1", cdf[len(cdf)-1])
+	}
+	cdf[len(cdf)-1] = 1
+
+	d := &EmpiricalDistr{rng: rng, values: values, cdf: cdf, interpolate: interpolate}
+	var m1, m2, prev float64
+	for i, v := range values {
+		p := cdf[i] - prev
+		prev = cdf[i]
+		if !interpolate || i == 0 {
+			m1 += p * v
+			m2 += p * v * v
+			continue
+		}
+		// uniform between the previous value and v
+		u := values[i-1]
+		m1 += p * (u + v) / 2
+		m2 += p * (u*u + u*v + v*v) / 3
+	}
+	d.mean = m1
+	d.variance = math.Max(m2-m1*m1, 0)
+	return d, nil
+}
+
+// NewEmpiricalDistr returns the distribution of the given samples. With
+// interpolation the samples are spread evenly between the smallest and the
+// largest one.
+func NewEmpiricalDistr(rng *rand.Rand, samples []float64, interpolate bool) *EmpiricalDistr {
+	d, err := empiricalFromSamples(rng, samples, interpolate)
+	if err != nil {
+		panic(fmt.Sprintf("Wrong empirical samples: %v\n", err))
+	}
+	return d
+}
+
+func empiricalFromSamples(rng *rand.Rand, samples []float64, interpolate bool) (*EmpiricalDistr, error) {
+	values := append([]float64(nil), samples...)
+	sort.Float64s(values)
+	n := len(values)
+	cdf := make([]float64, n)
+	for i := range cdf {
+		if interpolate && n > 1 {
+			cdf[i] = float64(i) / float64(n-1)
+		} else {
+			cdf[i] = float64(i+1) / float64(n)
+		}
+	}
+	return newEmpiricalDistr(rng, values, cdf, interpolate)
+}
+
+// NewEmpiricalDistrCDF returns the distribution with P(X <= values[i]) =
+// probs[i]. Both have to be increasing and the last probability 1. With
+// interpolation the first value still has probability probs[0].
+func NewEmpiricalDistrCDF(rng *rand.Rand, values, probs []float64, interpolate bool) *EmpiricalDistr {
+	d, err := newEmpiricalDistr(rng, append([]float64(nil), values...), append([]float64(nil), probs...), interpolate)
+	if err != nil {
+		panic(fmt.Sprintf("Wrong empirical cdf: %v\n", err))
+	}
+	return d
+}
+
+// LoadEmpiricalDistr reads an empirical distribution from a file. Every line
+// holds either a sample, or a value and its cumulative probability, separated
+// by a comma or spaces. Empty lines, lines starting with # and a header line
+// are skipped.
+func LoadEmpiricalDistr(rng *rand.Rand, path string, interpolate bool) (*EmpiricalDistr, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cols [2][]float64
+	width := 0
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("%v:%v: expected a sample or a value and a probability", path, line)
+		}
+		var row [2]float64
+		var perr error
+		for i, field := range fields {
+			if row[i], perr = strconv.ParseFloat(field, 64); perr != nil {
+				break
+			}
+		}
+		if perr != nil {
+			if width == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("%v:%v: %v", path, line, perr)
+		}
+		if width == 0 {
+			width = len(fields)
+		} else if len(fields) != width {
+			return nil, fmt.Errorf("%v:%v: expected %v columns", path, line, width)
+		}
+		for i := 0; i < width; i++ {
+			cols[i] = append(cols[i], row[i])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var d *EmpiricalDistr
+	if width == 0 {
+		return nil, fmt.Errorf("%v: no samples", path)
+	}
+	if width == 1 {
+		d, err = empiricalFromSamples(rng, cols[0], interpolate)
+	} else {
+		d, err = newEmpiricalDistr(rng, cols[0], cols[1], interpolate)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return d, nil
+}
+
+// WithRand returns a copy of the distribution sampling from rng
+func (distr *EmpiricalDistr) WithRand(rng *rand.Rand) *EmpiricalDistr {
+	d := *distr
+	d.rng = rng
+	return &d
+}
+
+// Mean returns the mean of the fitted distribution
+func (distr *EmpiricalDistr) Mean() float64 {
+	return distr.mean
+}
+
+// Variance returns the variance of the fitted distribution
+func (distr *EmpiricalDistr) Variance() float64 {
+	return distr.variance
+}
+
+func (distr *EmpiricalDistr) String() string {
+	return fmt.Sprintf("empirical distribution of %v points, mean %v, variance %v",
+		len(distr.values), distr.mean, distr.variance)
+}
+
+func (distr *EmpiricalDistr) GetRand() float64 {
+	u := distr.rng.Float64()
+	i := sort.Search(len(distr.cdf), func(i int) bool { return distr.cdf[i] > u })
+	if !distr.interpolate || i == 0 {
+		return distr.values[i]
+	}
+	lo, hi := distr.cdf[i-1], distr.cdf[i]
+	return distr.values[i-1] + (u-lo)/(hi-lo)*(distr.values[i]-distr.values[i-1])
+}
@@ -0,0 +1,200 @@
+package blocks
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	bUCKET_COUNT = 100000
+	gRANULARITY  = 10
+)
+
+// DefaultPercentiles are the quantiles reported if none are configured
+var DefaultPercentiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// bucketLayout maps samples to histogram buckets
+type bucketLayout interface {
+	bucketCount() int
+	index(s float64) int // might be >= bucketCount() for overflowing samples
+	lower(i int) float64 // lower bound of bucket i
+	upper(i int) float64 // upper bound of bucket i
+}
+
+// linearLayout has equal width buckets starting at 0
+type linearLayout struct {
+	granularity float64
+	buckets     int
+}
+
+func (l *linearLayout) bucketCount() int {
+	return l.buckets
+}
+
+func (l *linearLayout) index(s float64) int {
+	return int(s / l.granularity)
+}
+
+func (l *linearLayout) lower(i int) float64 {
+	return l.granularity * float64(i)
+}
+
+func (l *linearLayout) upper(i int) float64 {
+	return l.granularity * float64(i+1)
+}
+
+// logLayout has buckets that grow geometrically, so that the relative error
+// of any value in a bucket is bounded, HDR histogram style. The first
+// bucket is [0, min).
+type logLayout struct {
+	min     float64
+	factor  float64
+	logF    float64
+	buckets int
+}
+
+// newLogLayout returns a layout covering [0, max) where every value above
+// min is within relErr of the middle of its bucket
+func newLogLayout(min, max, relErr float64) *logLayout {
+	if min <= 0 || max <= min || relErr <= 0 {
+		panic(fmt.Sprintf("Wrong log histogram: min=%v max=%v error=%v\n", min, max, relErr))
+	}
+	l := &logLayout{min: min, factor: 1 + 2*relErr}
+	l.logF = math.Log(l.factor)
+	l.buckets = 2 + int(math.Ceil(math.Log(max/min)/l.logF))
+	return l
+}
+
+func (l *logLayout) bucketCount() int {
+	return l.buckets
+}
+
+func (l *logLayout) index(s float64) int {
+	if s < l.min {
+		return 0
+	}
+	return 1 + int(math.Log(s/l.min)/l.logF)
+}
+
+func (l *logLayout) lower(i int) float64 {
+	if i == 0 {
+		return 0
+	}
+	return l.min * math.Pow(l.factor, float64(i-1))
+}
+
+func (l *logLayout) upper(i int) float64 {
+	return l.min * math.Pow(l.factor, float64(i))
+}
+
+type histogram struct {
+	layout     bucketLayout
+	buckets    []int
+	count      int64
+	overflow   int64 // samples beyond the last bucket, counted in it
+	minBucket  int
+	maxBucket  int
+	min        float64 // smallest and largest sample, estimates are
+	max        float64 // clamped to them
+	sum        float64
+	sum_square float64
+}
+
+func newHistogram(layout bucketLayout) *histogram {
+	return &histogram{
+		layout:    layout,
+		buckets:   make([]int, layout.bucketCount()),
+		minBucket: layout.bucketCount() - 1,
+		maxBucket: 0,
+	}
+}
+
+func newLinearHistogram(granularity float64, buckets int) *histogram {
+	if granularity <= 0 || buckets <= 0 {
+		panic(fmt.Sprintf("Wrong linear histogram: granularity=%v buckets=%v\n", granularity, buckets))
+	}
+	return newHistogram(&linearLayout{granularity: granularity, buckets: buckets})
+}
+
+func (hdr *histogram) addSample(s float64) {
+	index := hdr.layout.index(s)
+	if index >= len(hdr.buckets) {
+		index = len(hdr.buckets) - 1
+		hdr.overflow++
+	}
+	if index < 0 || index >= len(hdr.buckets) {
+		panic(fmt.Sprintf("Wrong index: %v\n", index))
+	}
+	hdr.buckets[index]++
+	if index > hdr.maxBucket {
+		hdr.maxBucket = index
+	}
+	if index < hdr.minBucket {
+		hdr.minBucket = index
+	}
+	if hdr.count == 0 || s < hdr.min {
+		hdr.min = s
+	}
+	if hdr.count == 0 || s > hdr.max {
+		hdr.max = s
+	}
+	hdr.count++
+	hdr.sum += s
+	hdr.sum_square += s * s
+}
+
+func (hdr *histogram) avg() float64 {
+	return hdr.sum / float64(hdr.count)
+}
+
+func (hdr *histogram) stddev() float64 {
+	square_avg := hdr.sum_square / float64(hdr.count)
+	mean := hdr.avg()
+
+	// rounding can make the variance of equal samples slightly negative
+	return math.Sqrt(math.Max(square_avg-mean*mean, 0))
+}
+
+func (hdr *histogram) width(i int) float64 {
+	return hdr.layout.upper(i) - hdr.layout.lower(i)
+}
+
+// getPercentiles estimates the given quantiles, sorted in increasing order.
+// The quantile q is the sample of rank q*count. Samples are assumed to be
+// uniformly spread within their bucket, so the estimate is interpolated
+// between the bounds of the bucket where the rank falls, and clamped to the
+// smallest and largest sample. Any number of quantiles can fall in the same
+// bucket.
+func (hdr *histogram) getPercentiles(percentiles []float64) map[float64]float64 {
+	res := map[float64]float64{}
+	if hdr.count == 0 {
+		return res
+	}
+	percentile_i := 0
+	accum := int64(0) // samples in the buckets before i
+	for i := hdr.minBucket; i <= hdr.maxBucket && percentile_i < len(percentiles); i++ {
+		n := int64(hdr.buckets[i])
+		if n == 0 {
+			continue
+		}
+		for percentile_i < len(percentiles) {
+			rank := percentiles[percentile_i] * float64(hdr.count)
+			if rank > float64(accum+n) {
+				break
+			}
+			frac := (rank - float64(accum)) / float64(n)
+			if frac < 0 {
+				frac = 0
+			}
+			v := hdr.layout.lower(i) + frac*hdr.width(i)
+			res[percentiles[percentile_i]] = math.Min(math.Max(v, hdr.min), hdr.max)
+			percentile_i++
+		}
+		accum += n
+	}
+	// rounding might leave the highest quantiles just above the last sample
+	for ; percentile_i < len(percentiles); percentile_i++ {
+		res[percentiles[percentile_i]] = hdr.max
+	}
+	return res
+}
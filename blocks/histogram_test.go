@@ -0,0 +1,112 @@
+package blocks
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+func checkPercentiles(t *testing.T, hdr *histogram, want map[float64]float64, tolerance float64) {
+	t.Helper()
+	var quantiles []float64
+	for q := range want {
+		quantiles = append(quantiles, q)
+	}
+	sort.Float64s(quantiles)
+	got := hdr.getPercentiles(quantiles)
+	for _, q := range quantiles {
+		v, ok := got[q]
+		if !ok {
+			t.Errorf("quantile %v: missing", q)
+			continue
+		}
+		if math.Abs(v-want[q]) > tolerance*math.Max(1, math.Abs(want[q])) {
+			t.Errorf("quantile %v: got %v, want %v", q, v, want[q])
+		}
+	}
+}
+
+func TestPercentilesSameBucket(t *testing.T) {
+	hdr := newLinearHistogram(10, 10)
+	// 100 samples evenly spread over [20, 30)
+	for i := 0; i < 100; i++ {
+		hdr.addSample(20 + float64(i)/10)
+	}
+	checkPercentiles(t, hdr, map[float64]float64{
+		0.1:  21,
+		0.25: 22.5,
+		0.5:  25,
+		0.9:  29,
+	}, 1e-9)
+}
+
+func TestPercentilesFirstBucket(t *testing.T) {
+	hdr := newLinearHistogram(10, 10)
+	// the first non-empty bucket is [50, 60)
+	for i := 0; i < 50; i++ {
+		hdr.addSample(50 + float64(i)/5)
+		hdr.addSample(60 + float64(i)/5)
+	}
+	if hdr.minBucket != 5 {
+		t.Fatalf("minBucket: got %v, want 5", hdr.minBucket)
+	}
+	checkPercentiles(t, hdr, map[float64]float64{
+		0.1:  52,
+		0.25: 55,
+		0.5:  60,
+		0.75: 65,
+	}, 1e-9)
+}
+
+func TestPercentilesClamped(t *testing.T) {
+	hdr := newLinearHistogram(10, 10)
+	hdr.addSample(3)
+	hdr.addSample(4)
+	// interpolating over the bucket would give 0.1 and 9.9
+	checkPercentiles(t, hdr, map[float64]float64{
+		0.01: 3,
+		0.99: 4,
+	}, 1e-9)
+}
+
+func TestPercentilesLogLayout(t *testing.T) {
+	relErr := 0.01
+	hdr := newHistogram(newLogLayout(1, 1e6, relErr))
+	// the quantile q of 1, 2, ..., 100000 is q*100000
+	n := 100000
+	for i := 1; i <= n; i++ {
+		hdr.addSample(float64(i))
+	}
+	want := map[float64]float64{}
+	for _, q := range []float64{0.01, 0.5, 0.9, 0.99, 0.999} {
+		want[q] = q * float64(n)
+	}
+	checkPercentiles(t, hdr, want, 2*relErr)
+}
+
+func TestPercentilesOverflow(t *testing.T) {
+	hdr := newLinearHistogram(1, 10)
+	for i := 0; i < 90; i++ {
+		hdr.addSample(float64(i) / 10)
+	}
+	for i := 0; i < 10; i++ {
+		hdr.addSample(1000)
+	}
+	if hdr.overflow != 10 {
+		t.Errorf("overflow: got %v, want 10", hdr.overflow)
+	}
+	checkPercentiles(t, hdr, map[float64]float64{0.5: 5}, 1e-9)
+	// the overflowing samples are counted in the last bucket
+	q := 0.99
+	v := hdr.getPercentiles([]float64{q})[q]
+	if v < 9 || v > 10 {
+		t.Errorf("quantile %v: got %v, want it in the last bucket [9, 10)", q, v)
+	}
+}
+
+func TestPercentilesEmpty(t *testing.T) {
+	hdr := newLinearHistogram(1, 10)
+	if res := hdr.getPercentiles(DefaultPercentiles); len(res) != 0 {
+		t.Errorf("got %v, want no estimates", res)
+	}
+}
@@ -2,6 +2,7 @@ package blocks
 
 import (
 	"container/list"
+	"math"
 	//	"fmt"
 
 	"github.com/marioskogias/schedsim/engine"
@@ -22,6 +23,7 @@ type genericProcessor struct {
 	engine.Actor
 	reqDrain RequestDrain
 	ctxCost  float64
+	busyTime
 }
 
 func (p *genericProcessor) GetGenericActor() *engine.Actor {
@@ -36,6 +38,17 @@ func (p *genericProcessor) SetCtxCost(cost float64) {
 	p.ctxCost = cost
 }
 
+func (p *genericProcessor) GetUtilization() Utilization {
+	return p.utilization(p.GetTime())
+}
+
+// serve spends the context switch cost and d time units of service
+func (p *genericProcessor) serve(d float64) {
+	p.start(p.GetTime(), p.ctxCost, d)
+	p.Wait(d + p.ctxCost)
+	p.end()
+}
+
 // Run to completion processor
 type RTCProcessor struct {
 	genericProcessor
@@ -44,12 +57,14 @@ type RTCProcessor struct {
 
 func (p *RTCProcessor) Run() {
 	for {
-		//		t1 := engine.GetTime()
+		//		t1 := p.GetTime()
 		req := p.ReadInQueue().(Request)
-		//		t2 := engine.GetTime()
+		req.dispatch(p.GetTime())
+		//		t2 := p.GetTime()
 		//		fmt.Printf("%v\n", t2-t1)
-		//fmt.Printf("Processor: read from queue val = %v TIME = %v\n", req.ServiceTime, engine.GetTime())
-		p.Wait(req.ServiceTime + p.ctxCost)
+		//fmt.Printf("Processor: read from queue val = %v TIME = %v\n", req.ServiceTime, p.GetTime())
+		p.serve(req.ServiceTime)
+		req.complete(p.GetTime())
 		p.reqDrain.TerminateReq(req)
 	}
 }
@@ -67,14 +82,18 @@ func NewTSProcessor(quantum float64) *TSProcessor {
 func (p *TSProcessor) Run() {
 	for {
 		req := p.ReadInQueue().(Request)
-		//fmt.Printf("Processor: read from queue val = %v TIME = %v\n", req.ServiceTime, engine.GetTime())
+		req.dispatch(p.GetTime())
+		//fmt.Printf("Processor: read from queue val = %v TIME = %v\n", req.ServiceTime, p.GetTime())
 
 		if req.ServiceTime <= p.quantum {
-			p.Wait(req.ServiceTime + p.ctxCost)
+			p.serve(req.ServiceTime)
+			req.complete(p.GetTime())
 			p.reqDrain.TerminateReq(req)
 		} else {
-			p.Wait(p.quantum + p.ctxCost)
+			p.serve(p.quantum)
+			p.preemptions++
 			req.ServiceTime -= p.quantum
+			req.preempt(p.GetTime())
 			p.WriteInQueue(req)
 		}
 	}
@@ -107,7 +126,10 @@ func (p *PSProcessor) getMinService() *list.Element {
 }
 
 func (p *PSProcessor) updateServiceTimes() {
-	currTime := engine.GetTime()
+	currTime := p.GetTime()
+	if p.count > 0 {
+		p.addBusy(currTime - p.prevTime)
+	}
 	diff := (currTime - p.prevTime) / float64(p.count)
 	//fmt.Printf("Diff = %v\n", diff)
 	p.prevTime = currTime
@@ -123,6 +145,21 @@ func (p *PSProcessor) updateServiceTimes() {
 	}
 }
 
+// GetUtilization also accounts for the requests in service since the last
+// event
+func (p *PSProcessor) GetUtilization() Utilization {
+	u := p.genericProcessor.GetUtilization()
+	if p.count > 0 {
+		d := p.GetTime() - p.prevTime
+		u.Busy += d
+		u.Idle = math.Max(u.Idle-d, 0)
+		if now := p.GetTime(); now > 0 {
+			u.Utilization = u.Busy / now
+		}
+	}
+	return u
+}
+
 func (p *PSProcessor) Run() {
 	var d float64
 	d = -1
@@ -132,12 +169,14 @@ func (p *PSProcessor) Run() {
 		p.updateServiceTimes()
 		if intr {
 			req := p.curr.Value.(*Request)
+			req.complete(p.GetTime())
 			p.reqDrain.TerminateReq(*req)
 			p.reqList.Remove(p.curr)
 			p.count--
 		} else {
 			p.count++
 			req := reqIntrf.(Request)
+			req.dispatch(p.GetTime())
 
 			reqPtr := &req
 			p.reqList.PushBack(reqPtr)
@@ -164,13 +203,17 @@ func NewHybridProcessor(quantum float64) *HybridProcessor {
 func (p *HybridProcessor) Run() {
 	for {
 		req := p.ReadInQueue().(Request)
-		//fmt.Printf("Processor: read from queue val = %v TIME = %v\n", req.ServiceTime, engine.GetTime())
+		req.dispatch(p.GetTime())
+		//fmt.Printf("Processor: read from queue val = %v TIME = %v\n", req.ServiceTime, p.GetTime())
 		if req.ServiceTime <= p.Threshold {
-			p.Wait(req.ServiceTime + p.ctxCost)
+			p.serve(req.ServiceTime)
+			req.complete(p.GetTime())
 			p.reqDrain.TerminateReq(req)
 		} else {
-			p.Wait(p.Threshold + p.ctxCost)
+			p.serve(p.Threshold)
+			p.preemptions++
 			req.ServiceTime -= p.Threshold
+			req.preempt(p.GetTime())
 			p.WriteOutQueue(req)
 		}
 	}
@@ -190,7 +233,9 @@ func (p *QoSProcessor) Run() {
 	for {
 		reqI, _ := p.ReadInQueuesW()
 		req := reqI.(Request)
-		p.Wait(req.ServiceTime + p.ctxCost)
+		req.dispatch(p.GetTime())
+		p.serve(req.ServiceTime)
+		req.complete(p.GetTime())
 		p.reqDrains[req.QoS].TerminateReq(req)
 	}
 }
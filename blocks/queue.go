@@ -5,33 +5,49 @@ import (
 	"container/list"
 	//"sort"
 	"fmt"
+	"sync/atomic"
 	//"github.com/marioskogias/schedsim/engine"
 )
 
-var count = 0
+// queue ids are unique across all simulations in the process
+var count int64
 
 // Simple FIFO queue
 type Queue struct {
-	l  *list.List
-	id int
+	bounded
+	l       *list.List
+	id      int64
+	monitor *QueueMonitor
 }
 
 func NewQueue() *Queue {
 	q := &Queue{}
 	q.l = list.New()
-	q.id = count
-	count++
+	q.id = atomic.AddInt64(&count, 1) - 1
 	return q
 }
 
 func (q *Queue) Enqueue(el interface{}) {
 	//fmt.Printf("time: %v, queue: %v, len: %v\n", engine.GetTime(), q.id, q.Len())
+	switch q.admit(q.Len()) {
+	case dropNew:
+		q.dropped(el)
+		return
+	case dropHead:
+		q.dropped(q.Dequeue())
+	}
 	q.l.PushBack(el)
+	if q.monitor != nil {
+		q.monitor.update(q.Len())
+	}
 }
 
 func (q *Queue) Dequeue() interface{} {
 	el := q.l.Front()
 	q.l.Remove(el)
+	if q.monitor != nil {
+		q.monitor.update(q.Len())
+	}
 	return el.Value
 }
 
@@ -39,6 +55,21 @@ func (q *Queue) Len() int {
 	return q.l.Len()
 }
 
+func (q *Queue) dropped(el interface{}) {
+	if q.monitor != nil {
+		q.monitor.drop()
+	}
+	q.drop(el)
+}
+
+func (q *Queue) SetMonitor(m *QueueMonitor) {
+	q.monitor = m
+}
+
+func (q *Queue) GetMonitor() *QueueMonitor {
+	return q.monitor
+}
+
 // PriorityQueue
 type Comparable interface {
 	GetCmpVal() float64
@@ -71,7 +102,9 @@ func (pq *pQueue) Pop() interface{} {
 }
 
 type PQueue struct {
-	pq pQueue
+	bounded
+	pq      pQueue
+	monitor *QueueMonitor
 }
 
 func NewPQueue() *PQueue {
@@ -83,20 +116,49 @@ func NewPQueue() *PQueue {
 }
 
 func (pq *PQueue) Enqueue(el interface{}) {
-	fmt.Printf("%v\t", pq.Len())
-	pq.PrintQueue()
-	fmt.Printf("\n")
+	//fmt.Printf("%v\t", pq.Len())
+	//pq.PrintQueue()
+	//fmt.Printf("\n")
+	switch pq.admit(pq.Len()) {
+	case dropNew:
+		pq.dropped(el)
+		return
+	case dropHead:
+		pq.dropped(pq.Dequeue())
+	}
 	heap.Push(&pq.pq, el)
+	if pq.monitor != nil {
+		pq.monitor.update(pq.Len())
+	}
 }
 
 func (pq *PQueue) Dequeue() interface{} {
-	return heap.Pop(&pq.pq)
+	el := heap.Pop(&pq.pq)
+	if pq.monitor != nil {
+		pq.monitor.update(pq.Len())
+	}
+	return el
 }
 
 func (pq *PQueue) Len() int {
 	return pq.pq.Len()
 }
 
+func (pq *PQueue) dropped(el interface{}) {
+	if pq.monitor != nil {
+		pq.monitor.drop()
+	}
+	pq.drop(el)
+}
+
+func (pq *PQueue) SetMonitor(m *QueueMonitor) {
+	pq.monitor = m
+}
+
+func (pq *PQueue) GetMonitor() *QueueMonitor {
+	return pq.monitor
+}
+
 func (pq *PQueue) PrintQueue() {
 	for _, v := range pq.pq {
 		fmt.Printf("%v\t", v.GetServiceTime())
@@ -0,0 +1,152 @@
+package blocks
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/marioskogias/schedsim/engine"
+)
+
+// QueueSample is the length of a queue at some point in time
+type QueueSample struct {
+	Time float64 `json:"time"`
+	Len  int     `json:"len"`
+}
+
+// QueueResult is what a queue monitor measured. AvgLen is the time weighted
+// average length after the warm up and Enqueues the number of enqueued
+// elements in the same period, preempted requests put back in the queue
+// included. Dropped counts the elements dropped by a bounded queue. Samples
+// are exported separately, see results.WriteQueueSeries.
+type QueueResult struct {
+	Name     string        `json:"name"`
+	AvgLen   float64       `json:"avg_len"`
+	MaxLen   int           `json:"max_len"`
+	Enqueues int64         `json:"enqueues"`
+	Dropped  int64         `json:"dropped"`
+	Samples  []QueueSample `json:"-"`
+}
+
+// QueueMonitor records the length of a queue over time. It keeps the time
+// weighted average and the maximum length and optionally a sampled time
+// series. Monitors are stats collectors, so they have to be registered to
+// the simulation with InitStats.
+type QueueMonitor struct {
+	Name       string
+	sim        *engine.Simulation
+	warmUpTime float64
+	len        int
+	last       float64 // time of the last change
+	area       float64 // integral of the length after the warm up
+	maxLen     int
+	enqueues   int64
+	dropped    int64
+	series     bool
+	interval   float64 // 0 samples on every change
+	nextSample float64
+	samples    []QueueSample
+}
+
+// Monitored is implemented by the queues that can report their length to a
+// QueueMonitor
+type Monitored interface {
+	SetMonitor(m *QueueMonitor)
+	GetMonitor() *QueueMonitor
+}
+
+func NewQueueMonitor(sim *engine.Simulation, name string) *QueueMonitor {
+	return &QueueMonitor{Name: name, sim: sim}
+}
+
+// SetSeries enables the time series. The length is sampled every interval
+// time units, or on every change if interval is 0.
+func (m *QueueMonitor) SetSeries(interval float64) {
+	if interval < 0 {
+		panic(fmt.Sprintf("Wrong sample interval: %v\n", interval))
+	}
+	m.series = true
+	m.interval = interval
+}
+
+// ParseSeries parses a time series interval: either a positive number of
+// time units or "change" to sample on every change
+func ParseSeries(s string) (float64, error) {
+	if s == "change" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("wrong queue series: %q", s)
+	}
+	return v, nil
+}
+
+// SetWarmUp excludes the first t time units from the average and maximum
+// length. The time series always starts at 0.
+func (m *QueueMonitor) SetWarmUp(t float64) {
+	m.warmUpTime = t
+}
+
+// advance accounts for the current length from the last change up to now
+func (m *QueueMonitor) advance(now float64) {
+	for m.series && m.interval > 0 && m.nextSample <= now {
+		m.samples = append(m.samples, QueueSample{m.nextSample, m.len})
+		m.nextSample += m.interval
+	}
+	if now >= m.warmUpTime {
+		from := m.last
+		if from < m.warmUpTime {
+			from = m.warmUpTime
+		}
+		m.area += float64(m.len) * (now - from)
+		if m.len > m.maxLen {
+			m.maxLen = m.len
+		}
+	}
+	m.last = now
+}
+
+func (m *QueueMonitor) update(l int) {
+	now := m.sim.GetTime()
+	m.advance(now)
+	if l > m.len && now >= m.warmUpTime {
+		m.enqueues++
+	}
+	m.len = l
+	if now >= m.warmUpTime && l > m.maxLen {
+		m.maxLen = l
+	}
+	if m.series && m.interval == 0 {
+		m.samples = append(m.samples, QueueSample{now, l})
+	}
+}
+
+func (m *QueueMonitor) drop() {
+	if m.sim.GetTime() >= m.warmUpTime {
+		m.dropped++
+	}
+}
+
+// GetResult returns the measurements up to the current simulation time
+func (m *QueueMonitor) GetResult() QueueResult {
+	m.advance(m.sim.GetTime())
+	res := QueueResult{Name: m.Name, MaxLen: m.maxLen, Enqueues: m.enqueues, Dropped: m.dropped, Samples: m.samples}
+	if elapsed := m.last - m.warmUpTime; elapsed > 0 {
+		res.AvgLen = m.area / elapsed
+	}
+	return res
+}
+
+func (m *QueueMonitor) PrintStats() {
+	res := m.GetResult()
+	fmt.Printf("Queue: %v\tAvgLen: %v\tMaxLen: %v\n", res.Name, res.AvgLen, res.MaxLen)
+}
+
+// PrintQueues prints the average and maximum length of the monitored queues
+func PrintQueues(w io.Writer, qs []QueueResult) {
+	fmt.Fprintf(w, "Queue\tAvgLen\tMaxLen\tEnqueues\tDropped\n")
+	for _, q := range qs {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", q.Name, q.AvgLen, q.MaxLen, q.Enqueues, q.Dropped)
+	}
+}
@@ -2,16 +2,15 @@ package blocks
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"os"
+	"sort"
+	"strconv"
 
 	"github.com/marioskogias/schedsim/engine"
 )
 
-const (
-	bUCKET_COUNT = 100000
-	gRANULARITY  = 10
-)
-
 type Request struct {
 	InitTime       float64
 	ServiceTime    float64
@@ -20,18 +19,45 @@ type Request struct {
 	DeadLine       float64
 	PropDelay      float64
 	QoS            int
+	Generator      string  // name of the generator that created the request
+	Label          string  // user defined class of the request
+	FirstDispatch  float64 // when a processor first started serving the request
+	Completion     float64
+	Served         float64 // time spent in processors, without the time back in queues after preemptions
+	dispatched     bool
+	lastDispatch   float64
 }
 
-func NewRequest(serviceTime float64) Request {
-	return Request{InitTime: engine.GetTime(), ServiceTime: serviceTime, serviceTimeImm: serviceTime}
+func NewRequest(initTime, serviceTime float64) Request {
+	return Request{InitTime: initTime, ServiceTime: serviceTime, serviceTimeImm: serviceTime}
 }
 
 func (r *Request) GetInitialServiceTime() float64 {
 	return r.serviceTimeImm
 }
 
-func (r *Request) getDelay() float64 {
-	return engine.GetTime() - r.InitTime + r.PropDelay
+func (r *Request) getDelay(now float64) float64 {
+	return now - r.InitTime + r.PropDelay
+}
+
+// dispatch records that a processor starts serving the request
+func (r *Request) dispatch(now float64) {
+	if !r.dispatched {
+		r.FirstDispatch = now
+		r.dispatched = true
+	}
+	r.lastDispatch = now
+}
+
+// preempt records that a processor stops serving the request before it
+// completes
+func (r *Request) preempt(now float64) {
+	r.Served += now - r.lastDispatch
+}
+
+func (r *Request) complete(now float64) {
+	r.Completion = now
+	r.Served += now - r.lastDispatch
 }
 
 func (r Request) GetCmpVal() float64 {
@@ -44,131 +70,496 @@ func (r Request) GetServiceTime() float64 {
 	return r.ServiceTime
 }
 
-type histogram struct {
-	granularity float64
-	buckets     []int
-	count       int64
-	minBucket   int
-	maxBucket   int
-	sum         float64
-	sum_square  float64
+// ClassKey selects how a BookKeeper splits requests into classes
+type ClassKey int
+
+const (
+	NoClasses ClassKey = iota
+	ClassByQoS
+	ClassByGenerator
+	ClassByLabel
+)
+
+func (r *Request) class(key ClassKey) string {
+	switch key {
+	case ClassByQoS:
+		return strconv.Itoa(r.QoS)
+	case ClassByGenerator:
+		return r.Generator
+	case ClassByLabel:
+		return r.Label
+	}
+	return ""
 }
 
-func newHistogram() *histogram {
-	return &histogram{
-		granularity: gRANULARITY,
-		buckets:     make([]int, bUCKET_COUNT),
-		minBucket:   bUCKET_COUNT - 1,
-		maxBucket:   0,
+// Metric is a per request quantity recorded by a BookKeeper
+type Metric int
+
+const (
+	Latency   Metric = iota // from creation to completion plus propagation
+	Waiting                 // from creation to the first dispatch
+	InService               // time in processors, summed over preemptions
+	Slowdown                // latency over the initial service time
+)
+
+var metricNames = []string{"latency", "waiting", "service", "slowdown"}
+
+func (m Metric) String() string {
+	return metricNames[m]
+}
+
+func ParseMetric(s string) (Metric, error) {
+	for i, n := range metricNames {
+		if n == s {
+			return Metric(i), nil
+		}
 	}
+	return 0, fmt.Errorf("unknown metric: %q", s)
 }
 
-func (hdr *histogram) addSample(s float64) {
-	index := int(s / hdr.granularity)
-	if index >= bUCKET_COUNT {
-		index = bUCKET_COUNT - 1
+// slowdown is dimensionless, so it is never recorded with the time histogram
+var slowdownLayout = newLogLayout(0.01, 1e6, 0.005)
+
+type BookKeeper struct {
+	name        string
+	sim         *engine.Simulation
+	percentiles []float64
+	newHdr      func() *histogram // for the time metrics
+
+	// the recorded metrics, latency always first, and their histograms
+	metrics []Metric
+	hdrs    []*histogram
+
+	// per class histograms, in order of appearance
+	classKey   ClassKey
+	classes    map[string][]*histogram
+	classNames []string
+
+	// requests dropped by bounded queues, see DropDrain
+	dropped      int64
+	classDropped map[string]int64
+
+	// warm-up: requests are recorded only after warmUpTime and after
+	// warmUpCount requests have completed
+	warmUpTime  float64
+	warmUpCount int64
+	skipped     int64
+	lastSkipped float64
+	warm        bool
+	startTime   float64 // when recording started
+
+	// batch means of every metric, created on the first recorded request
+	batchSize int
+	batches   []*batchMeans
+
+	// stopping conditions, see SetStopAfter and SetStopPrecision
+	stopAfter int64
+	stopDone  func()
+	precision *precisionStop
+}
+
+func NewBookKeeper(sim *engine.Simulation) *BookKeeper {
+	b := &BookKeeper{
+		sim:         sim,
+		percentiles: DefaultPercentiles,
+		metrics:     []Metric{Latency},
 	}
-	if index < 0 || index >= bUCKET_COUNT {
-		panic(fmt.Sprintf("Wrong index: %v\n", index))
+	b.setHistogram(func() *histogram {
+		return newLinearHistogram(gRANULARITY, bUCKET_COUNT)
+	})
+	return b
+}
+
+func (b *BookKeeper) newHistograms() []*histogram {
+	res := make([]*histogram, len(b.metrics))
+	for i, m := range b.metrics {
+		if m == Slowdown {
+			res[i] = newHistogram(slowdownLayout)
+		} else {
+			res[i] = b.newHdr()
+		}
 	}
-	hdr.buckets[index]++
-	if index > hdr.maxBucket {
-		hdr.maxBucket = index
+	return res
+}
+
+// reset drops all the recorded samples
+func (b *BookKeeper) reset() {
+	b.hdrs = b.newHistograms()
+	b.classes = map[string][]*histogram{}
+	b.classNames = nil
+	b.dropped = 0
+	b.classDropped = map[string]int64{}
+	b.batches = nil
+}
+
+func (b *BookKeeper) setHistogram(newHdr func() *histogram) {
+	b.newHdr = newHdr
+	b.reset()
+}
+
+// SetMetrics sets the metrics recorded next to the latency. It drops any
+// recorded samples and should be called before the run.
+func (b *BookKeeper) SetMetrics(metrics ...Metric) {
+	b.metrics = []Metric{Latency}
+	for _, m := range metrics {
+		dup := false
+		for _, e := range b.metrics {
+			dup = dup || e == m
+		}
+		if !dup {
+			b.metrics = append(b.metrics, m)
+		}
 	}
-	if index < hdr.minBucket {
-		hdr.minBucket = index
+	b.reset()
+}
+
+// SetClassKey makes the book keeper keep separate statistics for every
+// class of requests, next to the aggregate ones
+func (b *BookKeeper) SetClassKey(key ClassKey) {
+	b.classKey = key
+}
+
+// SetPercentiles sets the quantiles to report, e.g. 0.999 for the 99.9th
+// percentile
+func (b *BookKeeper) SetPercentiles(percentiles []float64) {
+	for _, p := range percentiles {
+		if p <= 0 || p >= 1 {
+			panic(fmt.Sprintf("Wrong percentile: %v\n", p))
+		}
 	}
-	hdr.count++
-	hdr.sum += s
-	hdr.sum_square += s * s
+	b.percentiles = append([]float64(nil), percentiles...)
+	sort.Float64s(b.percentiles)
 }
 
-func (hdr *histogram) avg() float64 {
-	return hdr.sum / float64(hdr.count)
+// SetLinearHistogram replaces the histograms of the time metrics with ones
+// of count buckets of the given width. Samples above count*granularity are
+// counted as overflow. It drops any recorded samples and should be called
+// before the run.
+func (b *BookKeeper) SetLinearHistogram(granularity float64, count int) {
+	newLinearHistogram(granularity, count) // check the parameters now
+	b.setHistogram(func() *histogram {
+		return newLinearHistogram(granularity, count)
+	})
 }
 
-func (hdr *histogram) stddev() float64 {
-	square_avg := hdr.sum_square / float64(hdr.count)
-	mean := hdr.avg()
+// SetLogHistogram replaces the histograms of the time metrics with
+// log-bucketed ones, where samples between min and max are estimated within
+// a relative error relErr. Samples above max are counted as overflow. It
+// drops any recorded samples and should be called before the run.
+func (b *BookKeeper) SetLogHistogram(min, max, relErr float64) {
+	layout := newLogLayout(min, max, relErr)
+	b.setHistogram(func() *histogram {
+		return newHistogram(layout)
+	})
+}
 
-	return math.Sqrt(square_avg - mean*mean)
+func (b *BookKeeper) SetName(name string) {
+	b.name = name
 }
 
-//FIXME: I assume that in every bucket there will be max one percentile
-func (hdr *histogram) getPercentiles() map[float64]float64 {
-	accum := make([]int, bUCKET_COUNT)
-	res := map[float64]float64{}
-	percentiles := []float64{0.5, 0.9, 0.95, 0.99}
-	percentile_i := 0
+// SetWarmUp makes the book keeper ignore the requests that complete before
+// the simulated time t or before the first count requests complete. Both
+// conditions have to hold for recording to start. The throughput is then
+// measured from the end of the warm-up.
+func (b *BookKeeper) SetWarmUp(t float64, count int64) {
+	b.warmUpTime = t
+	b.warmUpCount = count
+}
 
-	accum[hdr.minBucket] = hdr.buckets[hdr.minBucket]
+// SetBatchMeans splits the recorded requests in batches of batchSize and
+// reports the 95% confidence interval of the average and the percentiles of
+// every metric, estimated from the batches. Batches should be large enough
+// for their estimates to be independent. Classes are not batched.
+func (b *BookKeeper) SetBatchMeans(batchSize int) {
+	if batchSize <= 1 {
+		panic(fmt.Sprintf("Wrong batch size: %v\n", batchSize))
+	}
+	b.batchSize = batchSize
+	b.batches = nil
+}
 
-	// what if percentiles in the first bucket
-	for float64(accum[hdr.minBucket]) > percentiles[percentile_i]*float64(hdr.count) {
-		// linear interpolation
-		res[percentiles[percentile_i]] = hdr.granularity / float64(hdr.buckets[hdr.minBucket]) * (percentiles[percentile_i] * float64(hdr.count))
-		percentile_i++
+// SetStopAfter ends the simulation once n requests have been recorded,
+// unless other stop conditions do not hold yet
+func (b *BookKeeper) SetStopAfter(n int64) {
+	if n <= 0 {
+		panic(fmt.Sprintf("Wrong stop count: %v\n", n))
 	}
-	if percentile_i >= len(percentiles) {
-		return res
+	b.stopAfter = n
+	b.stopDone = b.sim.NewStopCondition()
+}
+
+// SetStopPrecision ends the simulation once the 95% confidence interval of
+// the mean latency, or of its quantile q if q > 0, is within relWidth of the
+// estimate on either side, unless other stop conditions do not hold yet. The
+// interval is estimated with batch means over batches of batchSize recorded
+// requests, after at least 10 batches.
+func (b *BookKeeper) SetStopPrecision(relWidth, q float64, batchSize int) {
+	if relWidth <= 0 {
+		panic(fmt.Sprintf("Wrong stop precision: %v\n", relWidth))
+	}
+	b.precision = &precisionStop{
+		relWidth: relWidth,
+		bm:       newBatchMeans([]float64{q}, batchSize),
+		done:     b.sim.NewStopCondition(),
+	}
+}
+
+func (b *BookKeeper) isWarm(now float64) bool {
+	if b.warm {
+		return true
 	}
+	if now < b.warmUpTime || b.skipped < b.warmUpCount {
+		b.skipped++
+		b.lastSkipped = now
+		return false
+	}
+	b.warm = true
+	b.startTime = math.Max(b.warmUpTime, b.lastSkipped)
+	return true
+}
 
-	for i := hdr.minBucket + 1; i <= hdr.maxBucket; i++ {
-		accum[i] = accum[i-1] + hdr.buckets[i]
-		for float64(accum[i]) > percentiles[percentile_i]*float64(hdr.count) {
-			// linear interpolation
-			down := hdr.granularity * float64(i-1)
+// classHistograms returns the histograms of class c, created on its first
+// request
+func (b *BookKeeper) classHistograms(c string) []*histogram {
+	hdrs, ok := b.classes[c]
+	if !ok {
+		hdrs = b.newHistograms()
+		b.classes[c] = hdrs
+		b.classNames = append(b.classNames, c)
+	}
+	return hdrs
+}
 
-			res[percentiles[percentile_i]] = down + hdr.granularity/float64(hdr.buckets[i])*(percentiles[percentile_i]*float64(hdr.count)-float64(accum[i-1]))
-			percentile_i++
-			if percentile_i >= len(percentiles) {
-				return res
+func (b *BookKeeper) TerminateReq(r Request) {
+	if !b.isWarm(b.sim.GetTime()) {
+		return
+	}
+	now := b.sim.GetTime()
+	r.dispatch(now) // for requests that no processor dispatched
+	var hdrs []*histogram
+	if b.classKey != NoClasses {
+		hdrs = b.classHistograms(r.class(b.classKey))
+	}
+	if b.batchSize > 0 && b.batches == nil {
+		quantiles := append([]float64{0}, b.percentiles...)
+		for range b.metrics {
+			b.batches = append(b.batches, newBatchMeans(quantiles, b.batchSize))
+		}
+	}
+	for i, m := range b.metrics {
+		var v float64
+		switch m {
+		case Latency:
+			v = r.getDelay(now)
+		case Waiting:
+			v = r.FirstDispatch - r.InitTime
+		case InService:
+			v = r.Served
+		case Slowdown:
+			if r.GetInitialServiceTime() <= 0 {
+				continue
 			}
+			v = r.getDelay(now) / r.GetInitialServiceTime()
+		}
+		b.hdrs[i].addSample(v)
+		if hdrs != nil {
+			hdrs[i].addSample(v)
+		}
+		if b.batches != nil {
+			b.batches[i].add(v)
+		}
+		if m == Latency && b.precision != nil {
+			b.precision.add(v)
 		}
 	}
-	return res
+	if b.stopAfter > 0 && b.hdrs[0].count == b.stopAfter {
+		b.stopDone()
+	}
 }
 
-func (hdr *histogram) printPercentiles() {
-	percentiles := hdr.getPercentiles()
-	vals := []float64{0.5, 0.9, 0.95, 0.99}
-	for _, v := range vals {
-		fmt.Printf("%vth: %v\t", int(v*100.0), percentiles[v])
+// dropDrain counts the requests it receives as dropped in a book keeper
+type dropDrain struct {
+	b *BookKeeper
+}
+
+func (d dropDrain) TerminateReq(r Request) {
+	b := d.b
+	// drops do not advance the warm-up, they are only counted after it
+	if !b.warm && (b.sim.GetTime() < b.warmUpTime || b.skipped < b.warmUpCount) {
+		return
 	}
-	fmt.Println()
+	b.dropped++
+	if b.classKey != NoClasses {
+		c := r.class(b.classKey)
+		b.classHistograms(c)
+		b.classDropped[c]++
+	}
+}
 
-	fmt.Printf("Req/time_unit:%v\n", float64(hdr.count)/engine.GetTime())
+// DropDrain returns a drain for the requests dropped by bounded queues. The
+// dropped requests are not recorded, but the book keeper reports how many
+// there were and which fraction of all the requests they are.
+func (b *BookKeeper) DropDrain() RequestDrain {
+	return dropDrain{b}
 }
 
-type BookKeeper struct {
-	hdr  *histogram
-	name string
+// Percentile is the value V of the quantile Q
+type Percentile struct {
+	Q float64 `json:"quantile"`
+	V float64 `json:"value"`
+}
+
+// Result summarizes the statistics of a metric collected by a BookKeeper.
+// If the book keeper splits requests into classes, Classes holds a result
+// per class. The result of the latency holds the results of any other
+// recorded metrics in Metrics, as well as the number of dropped requests
+// and their fraction of all the requests.
+type Result struct {
+	Name        string       `json:"name"`
+	Metric      string       `json:"metric"`
+	Class       string       `json:"class,omitempty"`
+	Count       int64        `json:"count"`
+	Avg         float64      `json:"avg"`
+	StdDev      float64      `json:"stddev"`
+	Percentiles []Percentile `json:"percentiles"`
+	Throughput  float64      `json:"throughput"`
+	Overflow    int64        `json:"overflow"` // samples beyond the histogram range
+	Dropped     int64        `json:"dropped,omitempty"`
+	DropRate    float64      `json:"drop_rate,omitempty"`
+	Batches     []Estimate   `json:"batches,omitempty"` // batch means, see SetBatchMeans
+	Classes     []Result     `json:"classes,omitempty"`
+	Metrics     []Result     `json:"metrics,omitempty"`
 }
 
-func NewBookKeeper() *BookKeeper {
-	return &BookKeeper{
-		hdr: newHistogram(),
+func (b *BookKeeper) histogramResult(hdr *histogram) Result {
+	res := Result{
+		Name:     b.name,
+		Count:    hdr.count,
+		Overflow: hdr.overflow,
 	}
+	if hdr.count == 0 {
+		for _, v := range b.percentiles {
+			res.Percentiles = append(res.Percentiles, Percentile{v, 0})
+		}
+		return res
+	}
+	res.Avg = hdr.avg()
+	res.StdDev = hdr.stddev()
+	// no throughput if no time passed since recording started
+	if elapsed := b.sim.GetTime() - b.startTime; elapsed > 0 {
+		res.Throughput = float64(hdr.count) / elapsed
+	}
+	percentiles := hdr.getPercentiles(b.percentiles)
+	for _, v := range b.percentiles {
+		res.Percentiles = append(res.Percentiles, Percentile{v, percentiles[v]})
+	}
+	return res
 }
 
-func (b *BookKeeper) SetName(name string) {
-	b.name = name
+func (b *BookKeeper) metricResult(i int) Result {
+	res := b.histogramResult(b.hdrs[i])
+	res.Metric = b.metrics[i].String()
+	// a confidence interval needs at least 2 batches
+	if b.batches != nil && b.batches[i].batches() >= 2 {
+		bm := b.batches[i]
+		for j, q := range bm.quantiles {
+			name := "avg"
+			if q > 0 {
+				name = "p" + PercentileLabel(q)
+			}
+			res.Batches = append(res.Batches, NewEstimate(name, bm.estimates[j]))
+		}
+	}
+	for _, c := range b.classNames {
+		cr := b.histogramResult(b.classes[c][i])
+		cr.Metric = res.Metric
+		cr.Class = c
+		res.Classes = append(res.Classes, cr)
+	}
+	return res
 }
 
-func (b *BookKeeper) TerminateReq(r Request) {
-	d := r.getDelay()
-	b.hdr.addSample(d)
+func setDropped(res *Result, dropped int64) {
+	res.Dropped = dropped
+	if dropped > 0 {
+		res.DropRate = float64(dropped) / float64(res.Count+dropped)
+	}
 }
 
-func (b *BookKeeper) PrintStats() {
-	fmt.Printf("Stats collector: %v\n", b.name)
-	fmt.Printf("Count\tAVG\tSTDDev\t50th\t90th\t95th\t99th Reqs/time_unit\n")
-	fmt.Printf("%v\t%v\t%v\t", b.hdr.count, b.hdr.avg(), b.hdr.stddev())
+func (b *BookKeeper) GetResult() Result {
+	res := b.metricResult(0)
+	setDropped(&res, b.dropped)
+	for i := range res.Classes {
+		setDropped(&res.Classes[i], b.classDropped[res.Classes[i].Class])
+	}
+	for i := 1; i < len(b.metrics); i++ {
+		res.Metrics = append(res.Metrics, b.metricResult(i))
+	}
+	return res
+}
+
+// PrintResult prints a result as a human readable table, with a row per
+// class after the aggregate one if the result has classes, followed by a
+// table for every other metric
+func PrintResult(w io.Writer, res Result) {
+	fmt.Fprintf(w, "Stats collector: %v\n", res.Name)
+	printTable(w, res)
+	for _, m := range res.Metrics {
+		fmt.Fprintf(w, "Metric: %v\n", m.Metric)
+		printTable(w, m)
+	}
+}
 
-	vals := []float64{0.5, 0.9, 0.95, 0.99}
-	percentiles := b.hdr.getPercentiles()
-	for _, v := range vals {
-		fmt.Printf("%v\t", percentiles[v])
+func printTable(w io.Writer, res Result) {
+	if len(res.Classes) > 0 {
+		fmt.Fprintf(w, "Class\t")
 	}
-	fmt.Printf("%v\n", float64(b.hdr.count)/engine.GetTime())
+	fmt.Fprintf(w, "Count\tAVG\tSTDDev\t")
+	for _, p := range res.Percentiles {
+		fmt.Fprintf(w, "%vth\t", PercentileLabel(p.Q))
+	}
+	fmt.Fprintf(w, "Reqs/time_unit")
+	if res.Dropped > 0 {
+		fmt.Fprintf(w, "\tDropped\tDropRate")
+	}
+	fmt.Fprintf(w, "\n")
+	rows := append([]Result{res}, res.Classes...)
+	for i, r := range rows {
+		if len(res.Classes) > 0 {
+			if i == 0 {
+				fmt.Fprintf(w, "all\t")
+			} else {
+				fmt.Fprintf(w, "%v\t", r.Class)
+			}
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t", r.Count, r.Avg, r.StdDev)
+		for _, p := range r.Percentiles {
+			fmt.Fprintf(w, "%v\t", p.V)
+		}
+		fmt.Fprintf(w, "%v", r.Throughput)
+		if res.Dropped > 0 {
+			fmt.Fprintf(w, "\t%v\t%v", r.Dropped, r.DropRate)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	if res.Overflow > 0 {
+		fmt.Fprintf(w, "Overflow: %v samples beyond the histogram range\n", res.Overflow)
+	}
+	if len(res.Batches) > 0 {
+		fmt.Fprintf(w, "Batch means over %v batches: ", res.Batches[0].Samples)
+		for _, e := range res.Batches {
+			fmt.Fprintf(w, "%v %v ±%v\t", e.Value, e.Mean, e.HalfWidth)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// PercentileLabel returns the percentile of quantile q, e.g. 99.9 for 0.999,
+// without floating point noise
+func PercentileLabel(q float64) string {
+	return strconv.FormatFloat(math.Round(q*100*1e9)/1e9, 'f', -1, 64)
+}
+
+func (b *BookKeeper) PrintStats() {
+	PrintResult(os.Stdout, b.GetResult())
 }
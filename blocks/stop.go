@@ -0,0 +1,119 @@
+package blocks
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/marioskogias/schedsim/engine"
+)
+
+// minBatches is the number of batches needed before the confidence interval
+// of the batch means is trusted
+const minBatches = 10
+
+// GenerateLimit ends the simulation once the generators sharing it have
+// generated a number of requests. The requests still in flight at that point
+// are not recorded.
+type GenerateLimit struct {
+	max   int64
+	count int64
+	done  func()
+}
+
+func NewGenerateLimit(sim *engine.Simulation, n int64) *GenerateLimit {
+	if n <= 0 {
+		panic(fmt.Sprintf("Wrong generate limit: %v\n", n))
+	}
+	return &GenerateLimit{max: n, done: sim.NewStopCondition()}
+}
+
+func (l *GenerateLimit) generated() {
+	l.count++
+	if l.count == l.max {
+		l.done()
+	}
+}
+
+// Limited is implemented by the generators that can share a GenerateLimit
+type Limited interface {
+	SetGenerateLimit(l *GenerateLimit)
+}
+
+// batchMeans splits a series of samples in consecutive batches and keeps
+// estimates per batch: the mean and the given quantiles, where a quantile of
+// 0 stands for the mean. With large enough batches the estimates are
+// roughly independent, even though consecutive samples are not.
+type batchMeans struct {
+	quantiles []float64
+	batchSize int
+	batch     []float64
+	estimates [][]float64 // per quantile, one per batch
+}
+
+func newBatchMeans(quantiles []float64, batchSize int) *batchMeans {
+	for _, q := range quantiles {
+		if q < 0 || q >= 1 {
+			panic(fmt.Sprintf("Wrong batch means quantile: %v\n", q))
+		}
+	}
+	if batchSize <= 1 {
+		panic(fmt.Sprintf("Wrong batch size: %v\n", batchSize))
+	}
+	return &batchMeans{
+		quantiles: quantiles,
+		batchSize: batchSize,
+		estimates: make([][]float64, len(quantiles)),
+	}
+}
+
+// add returns true when the sample completes a batch
+func (bm *batchMeans) add(s float64) bool {
+	bm.batch = append(bm.batch, s)
+	if len(bm.batch) < bm.batchSize {
+		return false
+	}
+	sort.Float64s(bm.batch)
+	for i, q := range bm.quantiles {
+		var e float64
+		if q > 0 {
+			e = bm.batch[int(math.Ceil(q*float64(len(bm.batch))))-1]
+		} else {
+			for _, v := range bm.batch {
+				e += v
+			}
+			e /= float64(len(bm.batch))
+		}
+		bm.estimates[i] = append(bm.estimates[i], e)
+	}
+	bm.batch = bm.batch[:0]
+	return true
+}
+
+func (bm *batchMeans) batches() int {
+	return len(bm.estimates[0])
+}
+
+// interval returns the estimate of quantile i and the half width of its 95%
+// confidence interval
+func (bm *batchMeans) interval(i int) (float64, float64) {
+	return ConfidenceInterval(bm.estimates[i])
+}
+
+// precisionStop ends the simulation once the confidence interval of the
+// batch means is narrow enough
+type precisionStop struct {
+	relWidth float64
+	bm       *batchMeans
+	done     func()
+}
+
+func (p *precisionStop) add(s float64) {
+	if !p.bm.add(s) || p.bm.batches() < minBatches {
+		return
+	}
+	mean, hw := p.bm.interval(0)
+	if hw <= p.relWidth*math.Abs(mean) {
+		p.done()
+	}
+}
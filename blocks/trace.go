@@ -0,0 +1,273 @@
+package blocks
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TraceRecord is a recorded request. Queue is the index of the out queue of
+// the generator to send it to, or -1 for round robin.
+type TraceRecord struct {
+	Arrival float64
+	Service float64
+	Class   int
+	Queue   int
+}
+
+// Trace is a sequence of recorded requests in arrival order
+type Trace struct {
+	Records []TraceRecord
+}
+
+// binaryTraceRecord is the layout of a record in a binary trace
+type binaryTraceRecord struct {
+	Arrival float64
+	Service float64
+	Class   int32
+	Queue   int32
+}
+
+// LoadTrace reads a trace file. Files ending in .bin are read with
+// ReadTraceBinary, all others with ReadTraceCSV.
+func LoadTrace(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var t *Trace
+	if strings.HasSuffix(path, ".bin") {
+		t, err = ReadTraceBinary(f)
+	} else {
+		t, err = ReadTraceCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return t, nil
+}
+
+// ReadTraceCSV reads a trace with a line per request: the arrival time, the
+// service time, the class and optionally the out queue. A first line
+// without any number is a header and is skipped.
+func ReadTraceCSV(r io.Reader) (*Trace, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	t := &Trace{}
+	for first := true; ; first = false {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("line %v: expected arrival, service, class and an optional queue", line)
+		}
+		if first && isHeader(fields) {
+			continue
+		}
+		rec, err := parseTraceRecord(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		if err := t.add(rec); err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+	}
+	return t, t.check()
+}
+
+// isHeader is true if none of the fields is a number
+func isHeader(fields []string) bool {
+	for _, f := range fields {
+		if _, err := strconv.ParseFloat(f, 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTraceRecord(fields []string) (TraceRecord, error) {
+	rec := TraceRecord{Queue: -1}
+	var err error
+	if rec.Arrival, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return rec, err
+	}
+	if rec.Service, err = strconv.ParseFloat(fields[1], 64); err != nil {
+		return rec, err
+	}
+	if rec.Class, err = strconv.Atoi(fields[2]); err != nil {
+		return rec, err
+	}
+	if len(fields) == 4 && fields[3] != "" {
+		if rec.Queue, err = strconv.Atoi(fields[3]); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+// ReadTraceBinary reads a trace of little endian records of a float64
+// arrival time, a float64 service time, an int32 class and an int32 out
+// queue, -1 for round robin
+func ReadTraceBinary(r io.Reader) (*Trace, error) {
+	t := &Trace{}
+	for i := 0; ; i++ {
+		var b binaryTraceRecord
+		err := binary.Read(r, binary.LittleEndian, &b)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %v: %v", i, err)
+		}
+		rec := TraceRecord{b.Arrival, b.Service, int(b.Class), int(b.Queue)}
+		if err := t.add(rec); err != nil {
+			return nil, fmt.Errorf("record %v: %v", i, err)
+		}
+	}
+	return t, t.check()
+}
+
+func (t *Trace) add(rec TraceRecord) error {
+	if n := len(t.Records); n > 0 && rec.Arrival < t.Records[n-1].Arrival {
+		return fmt.Errorf("arrival %v before the previous one", rec.Arrival)
+	}
+	if rec.Service < 0 {
+		return fmt.Errorf("negative service time %v", rec.Service)
+	}
+	if rec.Queue < -1 {
+		return fmt.Errorf("wrong queue %v", rec.Queue)
+	}
+	t.Records = append(t.Records, rec)
+	return nil
+}
+
+func (t *Trace) check() error {
+	if len(t.Records) == 0 {
+		return fmt.Errorf("empty trace")
+	}
+	return nil
+}
+
+// Queues returns the number of out queues the records are sent to: one more
+// than the largest recorded queue, or 0 if all go in round robin
+func (t *Trace) Queues() int {
+	n := 0
+	for _, r := range t.Records {
+		if r.Queue >= n {
+			n = r.Queue + 1
+		}
+	}
+	return n
+}
+
+// Classes returns the smallest and the largest class of the records
+func (t *Trace) Classes() (int, int) {
+	min, max := t.Records[0].Class, t.Records[0].Class
+	for _, r := range t.Records {
+		if r.Class < min {
+			min = r.Class
+		}
+		if r.Class > max {
+			max = r.Class
+		}
+	}
+	return min, max
+}
+
+// period returns the time between two loops of the trace: its span and the
+// mean interarrival time, so that the first request of a loop does not
+// arrive together with the last one of the previous loop
+func (t *Trace) period() float64 {
+	n := len(t.Records)
+	if n < 2 {
+		return 0
+	}
+	span := t.Records[n-1].Arrival - t.Records[0].Arrival
+	return span * float64(n) / float64(n-1)
+}
+
+// TraceGenerator replays a trace. Requests are sent at their recorded
+// arrival times multiplied by the time scale, or right away if that time
+// has passed. Requests carry their class as QoS and go to their recorded
+// out queue, or in round robin. Without looping the generator is done after
+// the last request.
+type TraceGenerator struct {
+	genericGenerator
+	trace  *Trace
+	scale  float64
+	loop   bool
+	rebase bool
+}
+
+func NewTraceGenerator(t *Trace) *TraceGenerator {
+	if t == nil || len(t.Records) == 0 {
+		panic("Empty trace\n")
+	}
+	return &TraceGenerator{trace: t, scale: 1}
+}
+
+// SetTimeScale multiplies the distances between arrivals by scale. A scale
+// below 1 compresses the trace and raises the load.
+func (g *TraceGenerator) SetTimeScale(scale float64) {
+	if !(scale > 0) {
+		panic(fmt.Sprintf("Wrong trace time scale: %v\n", scale))
+	}
+	g.scale = scale
+}
+
+// SetRebase shifts the trace so that its first request is sent when the
+// generator starts, instead of at its recorded arrival time
+func (g *TraceGenerator) SetRebase(rebase bool) {
+	g.rebase = rebase
+}
+
+// SetLoop makes the generator replay the trace for ever
+func (g *TraceGenerator) SetLoop(loop bool) {
+	if loop && g.trace.period() <= 0 {
+		panic("Cannot loop a trace without a duration\n")
+	}
+	g.loop = loop
+}
+
+func (g *TraceGenerator) Run() {
+	if n := g.trace.Queues(); n > g.OutQueueCount() {
+		panic(fmt.Sprintf("Trace needs %v out queues, the generator has %v\n", n, g.OutQueueCount()))
+	}
+	records := g.trace.Records
+	// the simulated time start matches the trace time first
+	var first, start float64
+	if g.rebase {
+		first, start = records[0].Arrival, g.GetTime()
+	}
+	for count := 0; ; {
+		for _, r := range records {
+			if d := start + (r.Arrival-first)*g.scale - g.GetTime(); d > 0 {
+				g.Wait(d)
+			}
+			req := g.newRequestWith(r.Service)
+			req.QoS = r.Class
+			q := r.Queue
+			if q < 0 {
+				q = count % g.OutQueueCount()
+				count++
+			}
+			g.WriteOutQueueI(req, q)
+		}
+		if !g.loop {
+			return
+		}
+		start += g.trace.period() * g.scale
+	}
+}
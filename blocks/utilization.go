@@ -0,0 +1,122 @@
+package blocks
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/marioskogias/schedsim/engine"
+)
+
+// Utilization reports how a processor spent its time. Busy is the time spent
+// serving requests, CtxSwitch the time spent on context switch costs and
+// Idle the rest. Utilization and CtxOverhead are Busy and CtxSwitch as
+// fractions of the elapsed time. Preemptions counts the requests that were
+// put back in a queue before they completed.
+type Utilization struct {
+	Processor   string  `json:"processor"`
+	Busy        float64 `json:"busy"`
+	CtxSwitch   float64 `json:"ctx_switch"`
+	Idle        float64 `json:"idle"`
+	Utilization float64 `json:"utilization"`
+	CtxOverhead float64 `json:"ctx_overhead"`
+	Preemptions int64   `json:"preemptions"`
+}
+
+// UtilizationReporter is implemented by the actors that account for their
+// busy time. The returned Utilization has no Processor name.
+type UtilizationReporter interface {
+	GetUtilization() Utilization
+}
+
+// ProcessorType returns the name of the processor type, as used in topology
+// files
+func ProcessorType(a engine.ActorInterface) string {
+	switch a.(type) {
+	case *RTCProcessor:
+		return "rtc"
+	case *TSProcessor:
+		return "ts"
+	case *PSProcessor:
+		return "ps"
+	case *HybridProcessor:
+		return "hybrid"
+	case *QoSProcessor:
+		return "qos"
+	}
+	return "unknown"
+}
+
+// busyTime accounts for the time of a processor. Every request slot starts
+// with the context switch cost followed by the service. The current slot is
+// kept apart, so that a run ending in the middle of it is accounted for
+// correctly.
+type busyTime struct {
+	busy        float64
+	ctx         float64
+	preemptions int64
+
+	slotStart   float64
+	slotCtx     float64
+	slotService float64
+}
+
+func (b *busyTime) start(now, ctx, service float64) {
+	b.slotStart, b.slotCtx, b.slotService = now, ctx, service
+}
+
+func (b *busyTime) end() {
+	b.busy += b.slotService
+	b.ctx += b.slotCtx
+	b.slotCtx, b.slotService = 0, 0
+}
+
+// addBusy accounts for service time spent outside of slots, e.g. by
+// processor sharing
+func (b *busyTime) addBusy(d float64) {
+	b.busy += d
+}
+
+func (b *busyTime) utilization(now float64) Utilization {
+	elapsed := now - b.slotStart
+	ctx := math.Min(elapsed, b.slotCtx)
+	service := math.Min(elapsed-ctx, b.slotService)
+	u := Utilization{
+		Busy:        b.busy + service,
+		CtxSwitch:   b.ctx + ctx,
+		Preemptions: b.preemptions,
+	}
+	u.Idle = math.Max(now-u.Busy-u.CtxSwitch, 0)
+	if now > 0 {
+		u.Utilization = u.Busy / now
+		u.CtxOverhead = u.CtxSwitch / now
+	}
+	return u
+}
+
+// TotalUtilization aggregates the utilization of several processors. Times
+// and preemptions are summed and the fractions are over the total elapsed
+// time of all the processors.
+func TotalUtilization(us []Utilization) Utilization {
+	total := Utilization{Processor: "all"}
+	for _, u := range us {
+		total.Busy += u.Busy
+		total.CtxSwitch += u.CtxSwitch
+		total.Idle += u.Idle
+		total.Preemptions += u.Preemptions
+	}
+	if elapsed := total.Busy + total.CtxSwitch + total.Idle; elapsed > 0 {
+		total.Utilization = total.Busy / elapsed
+		total.CtxOverhead = total.CtxSwitch / elapsed
+	}
+	return total
+}
+
+// PrintUtilization prints a row per processor followed by the aggregate
+func PrintUtilization(w io.Writer, us []Utilization, total Utilization) {
+	fmt.Fprintf(w, "Processor\tBusy\tCtxSwitch\tIdle\tUtilization\tCtxOverhead\tPreemptions\n")
+	for _, u := range append(us, total) {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", u.Processor, u.Busy, u.CtxSwitch,
+			u.Idle, u.Utilization, u.CtxOverhead, u.Preemptions)
+	}
+}
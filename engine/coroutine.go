@@ -0,0 +1,22 @@
+//go:build go1.23
+
+package engine
+
+import "iter"
+
+// startCoroutine runs an actor as a coroutine until it first suspends
+func (m *Simulation) startCoroutine(a ActorInterface) {
+	ga := a.GetGenericActor()
+	ga.next, ga.stop = iter.Pull(func(yield func(interface{}) bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(errStopped); !ok {
+					panic(r)
+				}
+			}
+		}()
+		ga.yield = yield
+		a.Run()
+	})
+	m.resume(ga)
+}
@@ -0,0 +1,8 @@
+//go:build !go1.23
+
+package engine
+
+// startCoroutine panics, the coroutine core using iter.Pull of Go 1.23
+func (m *Simulation) startCoroutine(a ActorInterface) {
+	panic("the coroutine core needs Go 1.23")
+}
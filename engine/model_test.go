@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fifo is a minimal queue for the tests
+type fifo struct {
+	els []interface{}
+}
+
+func (q *fifo) Enqueue(el interface{}) {
+	q.els = append(q.els, el)
+}
+
+func (q *fifo) Dequeue() interface{} {
+	el := q.els[0]
+	q.els = q.els[1:]
+	return el
+}
+
+func (q *fifo) Len() int {
+	return len(q.els)
+}
+
+type testActor struct {
+	Actor
+	run func(a *Actor)
+}
+
+func (a *testActor) Run() {
+	a.run(&a.Actor)
+}
+
+func (a *testActor) GetGenericActor() *Actor {
+	return &a.Actor
+}
+
+func newTestActor(run func(a *Actor)) *testActor {
+	return &testActor{run: run}
+}
+
+var cores = []Core{GoroutineCore, CoroutineCore}
+
+// benchmarkMMc simulates about n requests of an M/M/c queue at load rho
+func benchmarkMMc(core Core, c, n int, rho float64) {
+	sim := NewSimulation(1)
+	sim.SetCore(core)
+	q := &fifo{}
+	for i := 0; i < c; i++ {
+		p := newTestActor(func(a *Actor) {
+			for {
+				a.ReadInQueue()
+				a.Wait(a.Rand().ExpFloat64())
+			}
+		})
+		p.AddInQueue(q)
+		sim.RegisterActor(p)
+	}
+	g := newTestActor(func(a *Actor) {
+		for i := 0; ; i++ {
+			a.Wait(a.Rand().ExpFloat64() / (rho * float64(c)))
+			a.WriteOutQueue(i)
+		}
+	})
+	g.AddOutQueue(q)
+	sim.RegisterActor(g)
+	sim.Run(float64(n) / (rho * float64(c)))
+}
+
+// BenchmarkCore reports the time per simulated request of an M/M/c queue
+// with either core
+func BenchmarkCore(b *testing.B) {
+	for _, core := range cores {
+		for _, c := range []int{1, 16} {
+			b.Run(fmt.Sprintf("%v/cores=%v", core, c), func(b *testing.B) {
+				benchmarkMMc(core, c, b.N, 0.8)
+			})
+		}
+	}
+}
+
+// received is an element read by an actor at a time
+type received struct {
+	time float64
+	el   interface{}
+}
+
+// reader returns an actor that reads with read and serves every element for
+// a time unit, logging what it read in log
+func reader(log *[]received, read func(a *Actor) interface{}) *testActor {
+	return newTestActor(func(a *Actor) {
+		for {
+			el := read(a)
+			*log = append(*log, received{a.GetTime(), el})
+			a.Wait(1)
+		}
+	})
+}
+
+// writer returns an actor that writes the elements to its out queues at
+// time 1, the element i to the out queue i
+func writer(els ...interface{}) *testActor {
+	return newTestActor(func(a *Actor) {
+		a.Wait(1)
+		for i, el := range els {
+			a.WriteOutQueueI(el, i)
+		}
+	})
+}
+
+// An actor that only reads its first input queue must not take the wake-up
+// of an element in another one
+func TestWakeUpOnlyReaders(t *testing.T) {
+	for _, core := range cores {
+		sim := NewSimulation(1)
+		sim.SetCore(core)
+		q1, q2 := &fifo{}, &fifo{}
+		var logA, logB []received
+		a := reader(&logA, func(a *Actor) interface{} { return a.ReadInQueue() })
+		a.AddInQueue(q1)
+		a.AddInQueue(q2)
+		sim.RegisterActor(a)
+		b := reader(&logB, func(a *Actor) interface{} { return a.ReadInQueue() })
+		b.AddInQueue(q2)
+		sim.RegisterActor(b)
+		w := writer("x")
+		w.AddOutQueue(q2)
+		sim.RegisterActor(w)
+		sim.Run(100)
+
+		if len(logA) != 0 {
+			t.Errorf("%v: A read %v from a queue it does not read", core, logA)
+		}
+		if len(logB) != 1 || logB[0] != (received{1, "x"}) {
+			t.Errorf("%v: B read %v, want x at time 1", core, logB)
+		}
+	}
+}
+
+// An actor woken up by an element that takes one from another queue
+// instead must pass the wake-up on
+func TestWakeUpPassedOn(t *testing.T) {
+	for _, core := range cores {
+		sim := NewSimulation(1)
+		sim.SetCore(core)
+		q1, q2 := &fifo{}, &fifo{}
+		var logA, logB []received
+		a := reader(&logA, func(a *Actor) interface{} {
+			el, _ := a.ReadInQueues()
+			return el
+		})
+		a.AddInQueue(q1)
+		a.AddInQueue(q2)
+		sim.RegisterActor(a)
+		b := reader(&logB, func(a *Actor) interface{} { return a.ReadInQueue() })
+		b.AddInQueue(q2)
+		sim.RegisterActor(b)
+		// the element of q2 wakes A up, which then prefers the one of q1
+		w := writer("x", "y")
+		w.AddOutQueue(q2)
+		w.AddOutQueue(q1)
+		sim.RegisterActor(w)
+		sim.Run(100)
+
+		if len(logA) != 1 || logA[0] != (received{1, "y"}) {
+			t.Errorf("%v: A read %v, want y at time 1", core, logA)
+		}
+		if len(logB) != 1 || logB[0] != (received{1, "x"}) {
+			t.Errorf("%v: B read %v, want x at time 1", core, logB)
+		}
+	}
+}
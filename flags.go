@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/marioskogias/schedsim/blocks"
+	"github.com/marioskogias/schedsim/engine"
+	"github.com/marioskogias/schedsim/results"
+	"github.com/marioskogias/schedsim/topologies"
+)
+
+// statsFlags holds the stats collection flags shared by the commands
+type statsFlags struct {
+	warmUpTime  float64
+	warmUpCount int64
+	percentiles string
+	histogram   string
+	classes     string
+	metrics     string
+	queueStats  bool
+	batchMeans  int
+}
+
+func addStatsFlags(fs *flag.FlagSet) *statsFlags {
+	sf := &statsFlags{}
+	fs.Float64Var(&sf.warmUpTime, "warmup-time", 0, "simulated time before the stats start recording")
+	fs.Int64Var(&sf.warmUpCount, "warmup-count", 0, "number of completed requests per stats collector before recording starts")
+	fs.StringVar(&sf.percentiles, "percentiles", "", "comma separated percentiles to report, e.g. 50,99,99.9,99.99")
+	fs.StringVar(&sf.histogram, "histogram", "", "latency histogram as linear:granularity:buckets or log:min:max:relative_error")
+	fs.StringVar(&sf.metrics, "metrics", "", "comma separated metrics recorded next to the latency: waiting, service, slowdown")
+	fs.StringVar(&sf.classes, "classes", "", "also report statistics per request class: qos, generator or label")
+	fs.IntVar(&sf.batchMeans, "batch-means", 0, "report confidence intervals from batch means over batches of this many requests")
+	fs.BoolVar(&sf.queueStats, "queue-stats", false, "report the time weighted average and maximum length of every queue")
+	return sf
+}
+
+// apply configures all the book keepers of the simulation
+func (sf *statsFlags) apply(sim *engine.Simulation) error {
+	spec := topologies.StatsSpec{Histogram: sf.histogram, Classes: sf.classes, BatchMeans: sf.batchMeans}
+	if sf.percentiles != "" {
+		p, err := topologies.ParsePercentiles(sf.percentiles)
+		if err != nil {
+			return err
+		}
+		spec.Percentiles = p
+	}
+	if sf.metrics != "" {
+		spec.Metrics = strings.Split(sf.metrics, ",")
+	}
+	if sf.queueStats {
+		monitorQueues(sim)
+	}
+	for _, s := range sim.GetStats() {
+		switch s := s.(type) {
+		case *blocks.BookKeeper:
+			s.SetWarmUp(sf.warmUpTime, sf.warmUpCount)
+			if err := spec.Apply(s); err != nil {
+				return err
+			}
+		case *blocks.QueueMonitor:
+			s.SetWarmUp(sf.warmUpTime)
+		}
+	}
+	return nil
+}
+
+// monitorQueues adds a monitor to every queue of the simulation that has
+// none and returns the monitors of all the queues. Queues without a name
+// are named after their order in the simulation.
+func monitorQueues(sim *engine.Simulation) []*blocks.QueueMonitor {
+	var res []*blocks.QueueMonitor
+	for i, q := range sim.GetQueues() {
+		mq, ok := q.(blocks.Monitored)
+		if !ok {
+			continue
+		}
+		m := mq.GetMonitor()
+		if m == nil {
+			m = blocks.NewQueueMonitor(sim, fmt.Sprintf("queue%v", i))
+			mq.SetMonitor(m)
+			sim.InitStats(m)
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+// queueSeriesFlags holds the queue time series flags of the commands that
+// run a single simulation
+type queueSeriesFlags struct {
+	series string
+	out    string
+}
+
+func addQueueSeriesFlags(fs *flag.FlagSet) *queueSeriesFlags {
+	qf := &queueSeriesFlags{}
+	fs.StringVar(&qf.series, "queue-series", "", "record the length of every queue every given time units, or on every \"change\"")
+	fs.StringVar(&qf.out, "queue-series-out", "queue_series.csv", "CSV file for the queue length series")
+	return qf
+}
+
+// apply enables the time series on every queue of the simulation. It has to
+// be called before statsFlags.apply, so that the warm up applies to the new
+// monitors.
+func (qf *queueSeriesFlags) apply(sim *engine.Simulation) error {
+	if qf.series == "" {
+		return nil
+	}
+	interval, err := blocks.ParseSeries(qf.series)
+	if err != nil {
+		return err
+	}
+	for _, m := range monitorQueues(sim) {
+		m.SetSeries(interval)
+	}
+	return nil
+}
+
+// write writes the series of the queues that recorded one
+func (qf *queueSeriesFlags) write(qs []blocks.QueueResult) error {
+	var series []blocks.QueueResult
+	for _, q := range qs {
+		if len(q.Samples) > 0 {
+			series = append(series, q)
+		}
+	}
+	if len(series) == 0 {
+		return nil
+	}
+	f, err := os.Create(qf.out)
+	if err != nil {
+		return err
+	}
+	if err := results.WriteQueueSeries(f, series); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// boundFlags bound every queue of the simulation
+type boundFlags struct {
+	topologies.BoundSpec
+}
+
+func addBoundFlags(fs *flag.FlagSet) *boundFlags {
+	bf := &boundFlags{}
+	fs.IntVar(&bf.Capacity, "queue-capacity", 0, "bound every queue to this many requests (0 means unbounded)")
+	fs.StringVar(&bf.DropPolicy, "drop-policy", "tail", "what a full queue drops: tail, head or red")
+	fs.IntVar(&bf.REDThreshold, "red-threshold", 0, "queue length where random early drop starts")
+	fs.Float64Var(&bf.REDMaxP, "red-max-p", 0.1, "random early drop probability just below the capacity")
+	return bf
+}
+
+// apply bounds all the queues of the simulation. The dropped requests are
+// counted by the first stats collector.
+func (bf *boundFlags) apply(sim *engine.Simulation) error {
+	if bf.Capacity == 0 {
+		return nil
+	}
+	var drain blocks.RequestDrain
+	for _, s := range sim.GetStats() {
+		if bk, ok := s.(*blocks.BookKeeper); ok {
+			drain = bk.DropDrain()
+			break
+		}
+	}
+	for _, q := range sim.GetQueues() {
+		if err := bf.Apply(sim, q, drain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopFlags end the run before its duration
+type stopFlags struct {
+	topologies.StopSpec
+}
+
+func addStopFlags(fs *flag.FlagSet) *stopFlags {
+	sf := &stopFlags{}
+	fs.Int64Var(&sf.Completed, "stop-completed", 0, "stop once every stats collector has recorded this many requests")
+	fs.Int64Var(&sf.Generated, "stop-generated", 0, "stop once the generators have generated this many requests")
+	fs.Float64Var(&sf.Precision, "stop-precision", 0, "stop once the 95% confidence interval of the latency is within this fraction of the estimate, e.g. 0.01")
+	fs.Float64Var(&sf.Percentile, "stop-percentile", 0, "percentile the precision refers to, e.g. 99 (0 means the mean)")
+	fs.IntVar(&sf.BatchSize, "stop-batch", 0, "requests per batch when estimating the precision (default 10000)")
+	return sf
+}
+
+// merge fills the unset flags from a topology file
+func (sf *stopFlags) merge(spec topologies.StopSpec) {
+	if sf.Completed == 0 {
+		sf.Completed = spec.Completed
+	}
+	if sf.Generated == 0 {
+		sf.Generated = spec.Generated
+	}
+	if sf.Precision == 0 {
+		sf.Precision = spec.Precision
+		if sf.Percentile == 0 {
+			sf.Percentile = spec.Percentile
+		}
+	}
+	if sf.BatchSize == 0 {
+		sf.BatchSize = spec.BatchSize
+	}
+}
+
+// simFlags are all the flags that configure a simulation once its topology
+// is built
+type simFlags struct {
+	core        *string
+	stats       *statsFlags
+	bounds      *boundFlags
+	stop        *stopFlags
+	queueSeries *queueSeriesFlags // nil for the commands that run many simulations
+}
+
+// addCoreFlag adds the flag selecting the engine core
+func addCoreFlag(fs *flag.FlagSet) *string {
+	return fs.String("engine", engine.GoroutineCore.String(), "how actors run: goroutine, or coroutine, single threaded and about twice as fast")
+}
+
+func addSimFlags(fs *flag.FlagSet, series bool) *simFlags {
+	sf := &simFlags{
+		core:   addCoreFlag(fs),
+		stats:  addStatsFlags(fs),
+		bounds: addBoundFlags(fs),
+		stop:   addStopFlags(fs),
+	}
+	if series {
+		sf.queueSeries = addQueueSeriesFlags(fs)
+	}
+	return sf
+}
+
+func (sf *simFlags) apply(sim *engine.Simulation) error {
+	if sf.queueSeries != nil {
+		if err := sf.queueSeries.apply(sim); err != nil {
+			return err
+		}
+	}
+	if err := sf.bounds.apply(sim); err != nil {
+		return err
+	}
+	if err := sf.stats.apply(sim); err != nil {
+		return err
+	}
+	return sf.stop.Apply(sim)
+}
+
+// simulate runs a simulation built by build and returns its results. The
+// caller fills in the topology and its parameters.
+func (sf *simFlags) simulate(seed int64, duration float64, build func(sim *engine.Simulation) error) (*results.Run, error) {
+	core, err := engine.ParseCore(*sf.core)
+	if err != nil {
+		return nil, err
+	}
+	sim := engine.NewSimulation(seed)
+	sim.SetCore(core)
+	if err := build(sim); err != nil {
+		return nil, err
+	}
+	if err := sf.apply(sim); err != nil {
+		return nil, err
+	}
+	sim.Run(duration)
+	run := &results.Run{
+		Seed:        seed,
+		Duration:    duration,
+		EndTime:     sim.GetTime(),
+		WarmUpTime:  sf.stats.warmUpTime,
+		WarmUpCount: sf.stats.warmUpCount,
+		Stats:       results.Collect(sim),
+		Processors:  results.CollectProcessors(sim),
+		Queues:      results.CollectQueues(sim),
+	}
+	run.Utilization = blocks.TotalUtilization(run.Processors)
+	return run, nil
+}
@@ -3,18 +3,132 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
 
+	"github.com/marioskogias/schedsim/engine"
+	"github.com/marioskogias/schedsim/results"
 	"github.com/marioskogias/schedsim/topologies"
 )
 
+var outputFormatUsage = "output format: " + strings.Join(results.Formats, ", ")
+
+// runParams returns the parameters of a topology in declaration order
+func runParams(t *topologies.Topology, params topologies.Params) []results.Param {
+	var res []results.Param
+	for _, p := range t.Params {
+		res = append(res, results.Param{Name: p.Name, Value: params[p.Name]})
+	}
+	return res
+}
+
+// registerParamFlags adds a flag for every parameter of every registered
+// topology. Parameters shared by several topologies get a single flag.
+func registerParamFlags() map[string]*float64 {
+	res := map[string]*float64{}
+	for _, t := range topologies.List() {
+		for _, p := range t.Params {
+			if _, ok := res[p.Name]; !ok {
+				res[p.Name] = flag.Float64(p.Name, p.Default, p.Usage)
+			}
+		}
+	}
+	return res
+}
+
+func listTopologies() {
+	for i, t := range topologies.List() {
+		fmt.Printf("%v\t%v\t%v\n", i, t.Name, t.Description)
+		for _, p := range t.Params {
+			fmt.Printf("\t-%v=%v\t%v\n", p.Name, p.Default, p.Usage)
+		}
+	}
+}
+
 func main() {
-	var topo = flag.Int("topo", 0, "topology selector")
-	var mu = flag.Float64("mu", 0.02, "mu service rate") // default 50usec
-	var lambda = flag.Float64("lambda", 0.005, "lambda poisson interarrival")
-	var duration = flag.Float64("duration", 10000000, "experiment duration")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			runFile(os.Args[2:])
+			return
+		case "sweep":
+			sweep(os.Args[2:])
+			return
+		case "validate":
+			validateCases(os.Args[2:])
+			return
+		}
+	}
+
+	var topo = flag.String("topo", "0", "topology name or index (see -list-topos)")
+	var listTopos = flag.Bool("list-topos", false, "list the available topologies and exit")
+	var duration = flag.Float64("duration", 10000000, "experiment duration, the upper bound if stop conditions are given")
+	var seed = flag.Int64("seed", 0, "random seed (0 picks one from the current time)")
+	var procs = flag.String("procs", "", "heterogeneous processor groups as type:count[:quantum|threshold],... e.g. rtc:4,ts:4:10")
+	var outputFormat = flag.String("output-format", "text", outputFormatUsage)
+	var replications = flag.Int("replications", 1, "number of independently seeded runs to report confidence intervals from")
+	var parallel = flag.Int("parallel", runtime.NumCPU(), "number of replications simulated in parallel")
+	sf := addSimFlags(flag.CommandLine, true)
+	paramFlags := registerParamFlags()
 
 	flag.Parse()
-	fmt.Printf("Selected topology: %v\n", *topo)
+	if *listTopos {
+		listTopologies()
+		return
+	}
+	t, err := topologies.Lookup(*topo)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	groups, err := topologies.ParseProcessors(*procs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	w, err := results.NewWriter(*outputFormat, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UTC().UnixNano()
+	}
+
+	// Only explicitly set flags override the topology defaults
+	params := t.DefaultParams()
+	flag.Visit(func(f *flag.Flag) {
+		if _, ok := params[f.Name]; ok {
+			params[f.Name] = *paramFlags[f.Name]
+		}
+		for _, p := range topologies.CoreParams {
+			if f.Name == p && len(groups) > 0 {
+				fmt.Fprintf(os.Stderr, "cannot set -%v with -procs\n", p)
+				os.Exit(1)
+			}
+		}
+	})
+
+	if len(groups) > 0 {
+		params["cores"] = float64(topologies.CountProcessors(groups))
+	}
 
-	topologies.SingleQueue(*lambda, *mu, *duration)
+	cfg := topologies.Config{Params: params, Processors: groups}
+	runOne := func(seed int64) (*results.Run, error) {
+		run, err := sf.simulate(seed, *duration, func(sim *engine.Simulation) error {
+			return t.Build(sim, cfg)
+		})
+		if err != nil {
+			return nil, err
+		}
+		run.Topology = t.Name
+		run.Params = runParams(t, params)
+		return run, nil
+	}
+	if err := writeRuns(w, sf, *replications, *parallel, *seed, runOne); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
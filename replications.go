@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/marioskogias/schedsim/results"
+)
+
+// replicate runs n replications in parallel, at most parallel at a time,
+// with seeds derived from seed and returns their runs in order
+func replicate(n, parallel int, seed int64, runOne func(seed int64) (*results.Run, error)) ([]*results.Run, error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	seeds := rand.New(rand.NewSource(seed))
+	runs := make([]*results.Run, n)
+	errs := make([]error, n)
+	sem := make(chan bool, parallel)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int, seed int64) {
+			defer wg.Done()
+			sem <- true
+			runs[i], errs[i] = runOne(seed)
+			<-sem
+		}(i, seeds.Int63())
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// writeRuns runs a single simulation, or replications of it if
+// replications > 1, and writes the run or the summary of the replications
+func writeRuns(w results.Writer, sf *simFlags, replications, parallel int, seed int64, runOne func(seed int64) (*results.Run, error)) error {
+	if replications > 1 {
+		if sf.queueSeries != nil && sf.queueSeries.series != "" {
+			return fmt.Errorf("queue series are not supported with replications")
+		}
+		runs, err := replicate(replications, parallel, seed, runOne)
+		if err != nil {
+			return err
+		}
+		if err := w.WriteSummary(results.Summarize(runs, seed)); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	run, err := runOne(seed)
+	if err != nil {
+		return err
+	}
+	if err := w.Write(run); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if sf.queueSeries != nil {
+		return sf.queueSeries.write(run.Queues)
+	}
+	return nil
+}
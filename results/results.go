@@ -0,0 +1,90 @@
+package results
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/marioskogias/schedsim/blocks"
+	"github.com/marioskogias/schedsim/engine"
+)
+
+// Param is a named run parameter. Parameters are kept in a slice, so that
+// they are always written in the same order.
+type Param struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// Run is the outcome of a single simulation run: how it was configured and
+// what every stats collector measured
+type Run struct {
+	Topology    string               `json:"topology"`
+	Params      []Param              `json:"params"`
+	Seed        int64                `json:"seed"`
+	Duration    float64              `json:"duration"`
+	EndTime     float64              `json:"end_time"` // before Duration if a stop condition held
+	WarmUpTime  float64              `json:"warmup_time"`
+	WarmUpCount int64                `json:"warmup_count"`
+	Stats       []blocks.Result      `json:"stats"`
+	Processors  []blocks.Utilization `json:"processors"`
+	Utilization blocks.Utilization   `json:"utilization"`
+	Queues      []blocks.QueueResult `json:"queues,omitempty"`
+}
+
+// Collect gathers the results of all the book keepers of a finished
+// simulation
+func Collect(sim *engine.Simulation) []blocks.Result {
+	var res []blocks.Result
+	for _, s := range sim.GetStats() {
+		if bk, ok := s.(*blocks.BookKeeper); ok {
+			res = append(res, bk.GetResult())
+		}
+	}
+	return res
+}
+
+// CollectQueues gathers the results of all the queue monitors of a finished
+// simulation
+func CollectQueues(sim *engine.Simulation) []blocks.QueueResult {
+	var res []blocks.QueueResult
+	for _, s := range sim.GetStats() {
+		if m, ok := s.(*blocks.QueueMonitor); ok {
+			res = append(res, m.GetResult())
+		}
+	}
+	return res
+}
+
+// WriteQueueSeries writes the sampled lengths of the given queues as CSV
+// with a queue, time and len column
+func WriteQueueSeries(w io.Writer, qs []blocks.QueueResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"queue", "time", "len"}); err != nil {
+		return err
+	}
+	for _, q := range qs {
+		for _, s := range q.Samples {
+			if err := cw.Write([]string{q.Name, formatFloat(s.Time), strconv.Itoa(s.Len)}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CollectProcessors gathers the utilization of all the processors of a
+// finished simulation. Processors are named by their type and index.
+func CollectProcessors(sim *engine.Simulation) []blocks.Utilization {
+	var res []blocks.Utilization
+	for _, a := range sim.GetActors() {
+		if r, ok := a.(blocks.UtilizationReporter); ok {
+			u := r.GetUtilization()
+			u.Processor = fmt.Sprintf("%v%v", blocks.ProcessorType(a), len(res))
+			res = append(res, u)
+		}
+	}
+	return res
+}
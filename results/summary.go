@@ -0,0 +1,119 @@
+package results
+
+import (
+	"github.com/marioskogias/schedsim/blocks"
+)
+
+// Estimate is the confidence interval of a value measured by a stats
+// collector, the processors or a queue. Stats is the name of the stats
+// collector, "processors" or "queue:" followed by the queue name. Metric and
+// Class are only set for stats collectors.
+type Estimate struct {
+	Stats  string `json:"stats"`
+	Metric string `json:"metric,omitempty"`
+	Class  string `json:"class,omitempty"`
+	blocks.Estimate
+}
+
+// Summary aggregates independent replications of the same configuration.
+// Seed is the seed the seeds of the replications were derived from.
+type Summary struct {
+	Topology     string     `json:"topology"`
+	Params       []Param    `json:"params"`
+	Seed         int64      `json:"seed"`
+	Replications int        `json:"replications"`
+	Duration     float64    `json:"duration"`
+	WarmUpTime   float64    `json:"warmup_time"`
+	WarmUpCount  int64      `json:"warmup_count"`
+	Estimates    []Estimate `json:"estimates"`
+}
+
+// value is a single measurement of a run
+type value struct {
+	key Estimate // without the estimate itself
+	v   float64
+}
+
+func resultValues(res blocks.Result, values []value) []value {
+	add := func(name string, v float64) {
+		key := Estimate{Stats: res.Name, Metric: res.Metric, Class: res.Class}
+		key.Value = name
+		values = append(values, value{key, v})
+	}
+	add("count", float64(res.Count))
+	add("avg", res.Avg)
+	add("stddev", res.StdDev)
+	for _, p := range res.Percentiles {
+		add(percentileName(p.Q), p.V)
+	}
+	add("throughput", res.Throughput)
+	if res.Dropped > 0 {
+		add("drop_rate", res.DropRate)
+	}
+	for _, c := range res.Classes {
+		values = resultValues(c, values)
+	}
+	for _, m := range res.Metrics {
+		values = resultValues(m, values)
+	}
+	return values
+}
+
+// runValues returns everything a run measured, in a stable order
+func runValues(r *Run) []value {
+	var values []value
+	for _, s := range r.Stats {
+		values = resultValues(s, values)
+	}
+	add := func(stats, name string, v float64) {
+		key := Estimate{Stats: stats}
+		key.Value = name
+		values = append(values, value{key, v})
+	}
+	if len(r.Processors) > 0 {
+		add("processors", "utilization", r.Utilization.Utilization)
+		add("processors", "ctx_overhead", r.Utilization.CtxOverhead)
+		add("processors", "preemptions", float64(r.Utilization.Preemptions))
+	}
+	for _, q := range r.Queues {
+		add("queue:"+q.Name, "avg_len", q.AvgLen)
+		add("queue:"+q.Name, "max_len", float64(q.MaxLen))
+		add("queue:"+q.Name, "dropped", float64(q.Dropped))
+	}
+	return values
+}
+
+// Summarize estimates every value measured by at least two of the runs.
+// The runs should be replications of the same configuration with
+// different seeds. The estimates are in the order of the first run that
+// measured them.
+func Summarize(runs []*Run, seed int64) *Summary {
+	s := &Summary{Seed: seed, Replications: len(runs)}
+	if len(runs) == 0 {
+		return s
+	}
+	first := runs[0]
+	s.Topology, s.Params, s.Duration = first.Topology, first.Params, first.Duration
+	s.WarmUpTime, s.WarmUpCount = first.WarmUpTime, first.WarmUpCount
+
+	var order []Estimate
+	samples := map[Estimate][]float64{}
+	for _, r := range runs {
+		for _, v := range runValues(r) {
+			if _, ok := samples[v.key]; !ok {
+				order = append(order, v.key)
+			}
+			samples[v.key] = append(samples[v.key], v.v)
+		}
+	}
+	for _, key := range order {
+		xs := samples[key]
+		if len(xs) < 2 {
+			continue
+		}
+		e := key
+		e.Estimate = blocks.NewEstimate(key.Value, xs)
+		s.Estimates = append(s.Estimates, e)
+	}
+	return s
+}
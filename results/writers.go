@@ -0,0 +1,308 @@
+package results
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/marioskogias/schedsim/blocks"
+)
+
+// Writer writes run results or replication summaries in some output
+// format. A writer should be given either runs or summaries, not both.
+// Flush must be called after the last one.
+type Writer interface {
+	Write(r *Run) error
+	WriteSummary(s *Summary) error
+	Flush() error
+}
+
+// Formats lists the supported output formats
+var Formats = []string{"text", "csv", "json", "jsonl"}
+
+// NewWriter returns a writer for the given format
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "text":
+		return &textWriter{w: w}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case "json":
+		return &jsonWriter{w: w}, nil
+	case "jsonl":
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown output format: %q", format)
+}
+
+// textWriter writes the human readable tables
+type textWriter struct {
+	w io.Writer
+}
+
+func (tw *textWriter) Write(r *Run) error {
+	fmt.Fprintf(tw.w, "Selected topology: %v\n", r.Topology)
+	for _, p := range r.Params {
+		fmt.Fprintf(tw.w, "%v:%v\t", p.Name, p.Value)
+	}
+	fmt.Fprintf(tw.w, "seed:%v\n", r.Seed)
+	if r.EndTime < r.Duration {
+		fmt.Fprintf(tw.w, "Stopped at time %v\n", r.EndTime)
+	}
+	for _, s := range r.Stats {
+		blocks.PrintResult(tw.w, s)
+	}
+	if len(r.Processors) > 0 {
+		blocks.PrintUtilization(tw.w, r.Processors, r.Utilization)
+	}
+	if len(r.Queues) > 0 {
+		blocks.PrintQueues(tw.w, r.Queues)
+	}
+	return nil
+}
+
+func (tw *textWriter) WriteSummary(s *Summary) error {
+	fmt.Fprintf(tw.w, "Selected topology: %v\n", s.Topology)
+	for _, p := range s.Params {
+		fmt.Fprintf(tw.w, "%v:%v\t", p.Name, p.Value)
+	}
+	fmt.Fprintf(tw.w, "seed:%v\treplications:%v\n", s.Seed, s.Replications)
+	fmt.Fprintf(tw.w, "Stats\tMetric\tClass\tValue\tMean\tCI95\n")
+	for _, e := range s.Estimates {
+		fmt.Fprintf(tw.w, "%v\t%v\t%v\t%v\t%v\t%v\n", e.Stats, e.Metric, e.Class, e.Value, e.Mean, e.HalfWidth)
+	}
+	return nil
+}
+
+func (tw *textWriter) Flush() error {
+	return nil
+}
+
+// csvWriter writes one row per run, stats collector and metric, followed by
+// a row per class if the collector has classes. The class of the aggregate
+// row is empty. Every row also carries the aggregate processor utilization
+// of the run and the half widths of the batch means confidence intervals, if
+// any. The percentile and confidence interval columns are those of all the
+// collectors of the first run, the cells of a collector without one being
+// empty.
+type csvWriter struct {
+	w           *csv.Writer
+	header      bool
+	percentiles []float64 // quantiles with a column
+	batches     []string  // values with a batch means confidence interval column
+}
+
+func percentileName(q float64) string {
+	return "p" + blocks.PercentileLabel(q)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func containsFloat(vs []float64, v float64) bool {
+	for _, w := range vs {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(vs []string, v string) bool {
+	for _, w := range vs {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+// addColumns adds the percentiles and batch means of s, its metrics and
+// classes that have no column yet
+func (cw *csvWriter) addColumns(s blocks.Result) {
+	for _, p := range s.Percentiles {
+		if !containsFloat(cw.percentiles, p.Q) {
+			cw.percentiles = append(cw.percentiles, p.Q)
+		}
+	}
+	for _, e := range s.Batches {
+		if !containsString(cw.batches, e.Value) {
+			cw.batches = append(cw.batches, e.Value)
+		}
+	}
+	for _, m := range s.Metrics {
+		cw.addColumns(m)
+	}
+	for _, c := range s.Classes {
+		cw.addColumns(c)
+	}
+}
+
+func (cw *csvWriter) writeHeader(r *Run) error {
+	for _, s := range r.Stats {
+		cw.addColumns(s)
+	}
+	sort.Float64s(cw.percentiles)
+	header := []string{"topology"}
+	for _, p := range r.Params {
+		header = append(header, p.Name)
+	}
+	header = append(header, "seed", "duration", "end_time", "warmup_time", "warmup_count", "stats", "metric", "class", "count", "avg", "stddev")
+	for _, q := range cw.percentiles {
+		header = append(header, percentileName(q))
+	}
+	header = append(header, "throughput", "overflow", "dropped", "drop_rate", "utilization", "ctx_overhead", "preemptions")
+	for _, v := range cw.batches {
+		header = append(header, v+"_ci95")
+	}
+	return cw.w.Write(header)
+}
+
+func (cw *csvWriter) writeRow(r *Run, s blocks.Result) error {
+	for _, p := range s.Percentiles {
+		if !containsFloat(cw.percentiles, p.Q) {
+			return fmt.Errorf("stats %v: no column for percentile %v", s.Name, percentileName(p.Q))
+		}
+	}
+	for _, e := range s.Batches {
+		if !containsString(cw.batches, e.Value) {
+			return fmt.Errorf("stats %v: no column for the confidence interval of %v", s.Name, e.Value)
+		}
+	}
+	row := []string{r.Topology}
+	for _, p := range r.Params {
+		row = append(row, formatFloat(p.Value))
+	}
+	row = append(row, strconv.FormatInt(r.Seed, 10), formatFloat(r.Duration), formatFloat(r.EndTime),
+		formatFloat(r.WarmUpTime), strconv.FormatInt(r.WarmUpCount, 10), s.Name, s.Metric, s.Class,
+		strconv.FormatInt(s.Count, 10), formatFloat(s.Avg), formatFloat(s.StdDev))
+	for _, q := range cw.percentiles {
+		v := ""
+		for _, p := range s.Percentiles {
+			if p.Q == q {
+				v = formatFloat(p.V)
+			}
+		}
+		row = append(row, v)
+	}
+	row = append(row, formatFloat(s.Throughput), strconv.FormatInt(s.Overflow, 10),
+		strconv.FormatInt(s.Dropped, 10), formatFloat(s.DropRate),
+		formatFloat(r.Utilization.Utilization), formatFloat(r.Utilization.CtxOverhead),
+		strconv.FormatInt(r.Utilization.Preemptions, 10))
+	for _, v := range cw.batches {
+		hw := ""
+		for _, e := range s.Batches {
+			if e.Value == v {
+				hw = formatFloat(e.HalfWidth)
+			}
+		}
+		row = append(row, hw)
+	}
+	return cw.w.Write(row)
+}
+
+func (cw *csvWriter) Write(r *Run) error {
+	if !cw.header {
+		if err := cw.writeHeader(r); err != nil {
+			return err
+		}
+		cw.header = true
+	}
+	for _, s := range r.Stats {
+		for _, m := range append([]blocks.Result{s}, s.Metrics...) {
+			if err := cw.writeRow(r, m); err != nil {
+				return err
+			}
+			for _, c := range m.Classes {
+				if err := cw.writeRow(r, c); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// flush on every run so that long sweeps can be followed
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// WriteSummary writes a row per estimate
+func (cw *csvWriter) WriteSummary(s *Summary) error {
+	if !cw.header {
+		header := []string{"topology"}
+		for _, p := range s.Params {
+			header = append(header, p.Name)
+		}
+		header = append(header, "seed", "replications", "duration", "warmup_time", "warmup_count",
+			"stats", "metric", "class", "value", "mean", "ci95")
+		if err := cw.w.Write(header); err != nil {
+			return err
+		}
+		cw.header = true
+	}
+	for _, e := range s.Estimates {
+		row := []string{s.Topology}
+		for _, p := range s.Params {
+			row = append(row, formatFloat(p.Value))
+		}
+		row = append(row, strconv.FormatInt(s.Seed, 10), strconv.Itoa(s.Replications),
+			formatFloat(s.Duration), formatFloat(s.WarmUpTime), strconv.FormatInt(s.WarmUpCount, 10),
+			e.Stats, e.Metric, e.Class, e.Value, formatFloat(e.Mean), formatFloat(e.HalfWidth))
+		if err := cw.w.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonWriter writes all the runs or summaries as a single JSON array on
+// Flush
+type jsonWriter struct {
+	w     io.Writer
+	items []interface{}
+}
+
+func (jw *jsonWriter) Write(r *Run) error {
+	jw.items = append(jw.items, r)
+	return nil
+}
+
+func (jw *jsonWriter) WriteSummary(s *Summary) error {
+	jw.items = append(jw.items, s)
+	return nil
+}
+
+func (jw *jsonWriter) Flush() error {
+	enc := json.NewEncoder(jw.w)
+	enc.SetIndent("", "  ")
+	if jw.items == nil {
+		jw.items = []interface{}{}
+	}
+	return enc.Encode(jw.items)
+}
+
+// jsonlWriter writes every run as a JSON object on its own line
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (jw *jsonlWriter) Write(r *Run) error {
+	return jw.enc.Encode(r)
+}
+
+func (jw *jsonlWriter) WriteSummary(s *Summary) error {
+	return jw.enc.Encode(s)
+}
+
+func (jw *jsonlWriter) Flush() error {
+	return nil
+}
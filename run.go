@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/marioskogias/schedsim/results"
+	"github.com/marioskogias/schedsim/topologies"
+)
+
+// runFile implements `schedsim run [flags] topology.yaml`
+func runFile(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var duration = fs.Float64("duration", 0, "experiment duration, the upper bound if stop conditions are given (overrides the file)")
+	var seed = fs.Int64("seed", 0, "random seed (0 picks one from the current time)")
+	var outputFormat = fs.String("output-format", "text", outputFormatUsage)
+	var replications = fs.Int("replications", 1, "number of independently seeded runs to report confidence intervals from")
+	var parallel = fs.Int("parallel", runtime.NumCPU(), "number of replications simulated in parallel")
+	sf := addSimFlags(fs, true)
+	stats, stop := sf.stats, sf.stop
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %v run [flags] topology.yaml\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	spec, err := topologies.LoadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, g := range spec.Generators {
+		reportEmpirical(g.Interarrival)
+		reportEmpirical(g.Service)
+	}
+	if *duration == 0 {
+		*duration = spec.Duration
+	}
+	if stats.warmUpTime == 0 {
+		stats.warmUpTime = spec.WarmUpTime
+	}
+	if stats.warmUpCount == 0 {
+		stats.warmUpCount = spec.WarmUpCount
+	}
+	stop.merge(spec.Stop)
+	w, err := results.NewWriter(*outputFormat, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *duration <= 0 {
+		fmt.Fprintln(os.Stderr, "no experiment duration given")
+		os.Exit(1)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UTC().UnixNano()
+	}
+
+	runOne := func(seed int64) (*results.Run, error) {
+		run, err := sf.simulate(seed, *duration, spec.Build)
+		if err != nil {
+			return nil, err
+		}
+		run.Topology = fs.Arg(0)
+		return run, nil
+	}
+	if err := writeRuns(w, sf, *replications, *parallel, *seed, runOne); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// reportEmpirical prints the fitted moments of the empirical distributions
+// in d
+func reportEmpirical(d topologies.DistSpec) {
+	if e := d.Empirical(); e != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", d.File, e)
+	}
+	for _, m := range d.Mix {
+		reportEmpirical(m)
+	}
+}
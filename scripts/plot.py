@@ -1,33 +1,14 @@
+import csv
 import numpy as np
 import matplotlib.pyplot as plt
 
 def parse_file(fname):
     res = []
     with open(fname, 'r') as f:
-        l = f.readline()
-        while l:
-            l = f.readline()
-            data = l.split("\t")
-            cores = int(data[0].split(":")[1])
-            mu = float(data[1].split(":")[1])
-            intr_lambda = float(data[0].split(":")[1])
-
-            l = f.readline() # skip the collector name
-            l = f.readline() # skip label
-            l = f.readline()
-            tmp = l.split("\t")
-
-            avg = float(tmp[1])
-            p50 = float(tmp[3])
-            p90 = float(tmp[4])
-            p95 = float(tmp[5])
-            p99 = float(tmp[6])
-            qps = float(tmp[7])
-
-            # compute rho
-            res.append((cores, mu, intr_lambda, qps, avg, p50, p90, p95, p99))
-
-            l = f.readline()
+        for row in csv.DictReader(f):
+            res.append((int(float(row["cores"])), float(row["mu"]), float(row["lambda"]),
+                        float(row["throughput"]), float(row["avg"]), float(row["p50"]),
+                        float(row["p90"]), float(row["p95"]), float(row["p99"])))
     return res
 
 def plot_data(data, name, p):
@@ -55,7 +36,7 @@ def plot_data(data, name, p):
 def main():
 
     # Plotting goes here
-    data = parse_file("data/single_queue.dat")
+    data = parse_file("data/single_queue.csv")
     plot_data(data,"M/M/8", 99)
 
     # plot horizontal line at 1
@@ -1,15 +1,10 @@
 #!/usr/bin/python
 
-import numpy as np
 from subprocess import call
-from scipy.stats import expon
-from math import log, sqrt
-
-mm116_lambdas = np.arange(0.1, 0.9, 0.1)
 
 def single_queue():
-    with open("data/single_queue.dat", 'w') as f:
-        [call(["schedsim","--lambda={}".format(l), "--mu=0.1", "--duration=1000000"], stdout=f) for l in mm116_lambdas]
+    with open("data/single_queue.csv", 'w') as f:
+        call(["schedsim", "sweep", "-topo=single_queue", "-p", "lambda=0.1:0.8:0.1", "-p", "mu=0.1", "-duration=1000000"], stdout=f)
 
 def main():
     single_queue()
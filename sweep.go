@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marioskogias/schedsim/engine"
+	"github.com/marioskogias/schedsim/results"
+	"github.com/marioskogias/schedsim/topologies"
+)
+
+// sweepFlag collects the repeated -p name=values flags
+type sweepFlag []string
+
+func (s *sweepFlag) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *sweepFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// parseValues parses either a comma separated list of values or an
+// inclusive range in the form start:stop:step
+func parseValues(s string) ([]float64, error) {
+	var res []float64
+	if strings.Contains(s, ":") {
+		fields := strings.Split(s, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("bad range: %q", s)
+		}
+		var r [3]float64
+		for i, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad range: %q", s)
+			}
+			r[i] = v
+		}
+		start, stop, step := r[0], r[1], r[2]
+		if step <= 0 || stop < start {
+			return nil, fmt.Errorf("bad range: %q", s)
+		}
+		// compute every value from start to avoid accumulating errors and
+		// round away the floating point noise
+		for i := 0; start+float64(i)*step <= stop+step*1e-9; i++ {
+			res = append(res, math.Round((start+float64(i)*step)*1e12)/1e12)
+		}
+		return res, nil
+	}
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad value: %q", f)
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// sweepPoints returns the cartesian product of the swept parameters. The
+// parameters that are not swept keep their default values.
+func sweepPoints(t *topologies.Topology, sweeps []string) ([]topologies.Params, error) {
+	points := []topologies.Params{t.DefaultParams()}
+	for _, s := range sweeps {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad parameter: %q", s)
+		}
+		if _, ok := points[0][kv[0]]; !ok {
+			return nil, fmt.Errorf("topology %v has no parameter %v", t.Name, kv[0])
+		}
+		vals, err := parseValues(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		var next []topologies.Params
+		for _, p := range points {
+			for _, v := range vals {
+				np := topologies.Params{}
+				for k, pv := range p {
+					np[k] = pv
+				}
+				np[kv[0]] = v
+				next = append(next, np)
+			}
+		}
+		points = next
+	}
+	return points, nil
+}
+
+type sweepResult struct {
+	run *results.Run
+	err error
+}
+
+func runPoint(t *topologies.Topology, cfg topologies.Config, seed int64, duration float64, sf *simFlags) sweepResult {
+	run, err := sf.simulate(seed, duration, func(sim *engine.Simulation) error {
+		return t.Build(sim, cfg)
+	})
+	if err != nil {
+		return sweepResult{err: err}
+	}
+	run.Topology = t.Name
+	run.Params = runParams(t, cfg.Params)
+	return sweepResult{run: run}
+}
+
+// sweep implements `schedsim sweep [flags]`. It runs the cartesian product
+// of the given parameter values in parallel and writes the result of every
+// point in order.
+func sweep(args []string) {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	var topo = fs.String("topo", "0", "topology name or index")
+	var duration = fs.Float64("duration", 10000000, "experiment duration of every point, the upper bound if stop conditions are given")
+	var seed = fs.Int64("seed", 0, "random seed the seeds of the points are derived from (0 picks one from the current time)")
+	var procs = fs.String("procs", "", "heterogeneous processor groups, see the main command, replacing the cores, quantum and threshold parameters")
+	var outputFormat = fs.String("output-format", "csv", outputFormatUsage)
+	sf := addSimFlags(fs, false)
+	var parallel = fs.Int("parallel", runtime.NumCPU(), "number of points simulated in parallel")
+	var sweeps sweepFlag
+	fs.Var(&sweeps, "p", "swept parameter as name=v1,v2,... or name=start:stop:step (repeatable)")
+	fs.Parse(args)
+
+	t, err := topologies.Lookup(*topo)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	groups, err := topologies.ParseProcessors(*procs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(groups) > 0 {
+		for _, s := range sweeps {
+			name := strings.SplitN(s, "=", 2)[0]
+			for _, p := range topologies.CoreParams {
+				if name == p {
+					fmt.Fprintf(os.Stderr, "cannot sweep %v with -procs\n", name)
+					os.Exit(1)
+				}
+			}
+		}
+	}
+	points, err := sweepPoints(t, sweeps)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	w, err := results.NewWriter(*outputFormat, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *parallel < 1 {
+		*parallel = 1
+	}
+	if *seed == 0 {
+		*seed = time.Now().UTC().UnixNano()
+	}
+	seeds := rand.New(rand.NewSource(*seed))
+
+	pending := make([]chan sweepResult, len(points))
+	sem := make(chan bool, *parallel)
+	var wg sync.WaitGroup
+	for i, p := range points {
+		if len(groups) > 0 {
+			p["cores"] = float64(topologies.CountProcessors(groups))
+		}
+		pending[i] = make(chan sweepResult, 1)
+		wg.Add(1)
+		go func(cfg topologies.Config, seed int64, out chan sweepResult) {
+			defer wg.Done()
+			sem <- true
+			out <- runPoint(t, cfg, seed, *duration, sf)
+			<-sem
+		}(topologies.Config{Params: p, Processors: groups}, seeds.Int63(), pending[i])
+	}
+
+	// write the results in order as soon as they are available
+	for _, ch := range pending {
+		res := <-ch
+		if res.err == nil {
+			res.err = w.Write(res.run)
+		}
+		if res.err != nil {
+			fmt.Fprintln(os.Stderr, res.err)
+			os.Exit(1)
+		}
+	}
+	wg.Wait()
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
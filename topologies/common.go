@@ -1,5 +1,280 @@
 package topologies
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/marioskogias/schedsim/blocks"
+	"github.com/marioskogias/schedsim/engine"
+)
+
 const (
-	cores = 8
+	defaultCores = 8
 )
+
+// ParseProcessors parses a list of heterogeneous processor groups in the
+// form type:count[:param],... e.g. "rtc:4,ts:4:10". The param is the
+// quantum of ts processors and the threshold of hybrid ones, both required.
+func ParseProcessors(s string) ([]ProcessorSpec, error) {
+	var res []ProcessorSpec
+	if s == "" {
+		return res, nil
+	}
+	for _, group := range strings.Split(s, ",") {
+		fields := strings.Split(group, ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("bad processor group: %q", group)
+		}
+		p := ProcessorSpec{Type: fields[0]}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("bad processor count: %q", group)
+		}
+		p.Count = count
+		if len(fields) == 3 {
+			v, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad processor parameter: %q", group)
+			}
+			p.Quantum = v
+			p.Threshold = v
+		} else if p.Type == "ts" || p.Type == "hybrid" {
+			return nil, fmt.Errorf("processor group %q: missing quantum or threshold, e.g. %v:%v:10", group, p.Type, p.Count)
+		}
+		if _, err := newProcessor(p); err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+// CoreParams are the topology parameters describing homogeneous processors.
+// Processor groups replace them.
+var CoreParams = []string{"cores", "quantum", "threshold"}
+
+// coreGroups returns the homogeneous processors described by the cores,
+// quantum and threshold parameters: time sharing processors if quantum is
+// set, hybrid ones if threshold is, run to completion ones otherwise
+func coreGroups(p Params) ([]ProcessorSpec, error) {
+	cores := int(p["cores"])
+	if cores <= 0 {
+		return nil, fmt.Errorf("bad core count: %v", p["cores"])
+	}
+	g := ProcessorSpec{Type: "rtc", Count: cores, Quantum: p["quantum"], Threshold: p["threshold"]}
+	switch {
+	case g.Quantum != 0 && g.Threshold != 0:
+		return nil, fmt.Errorf("both a quantum and a threshold are set")
+	case g.Quantum != 0:
+		g.Type = "ts"
+	case g.Threshold != 0:
+		g.Type = "hybrid"
+	}
+	if _, err := newProcessor(g); err != nil {
+		return nil, err
+	}
+	return []ProcessorSpec{g}, nil
+}
+
+// newProcessors creates the processors of the given groups, or cores run
+// to completion processors if there are no groups
+func newProcessors(groups []ProcessorSpec, cores int) ([]blocks.Processor, error) {
+	if len(groups) == 0 {
+		if cores <= 0 {
+			return nil, fmt.Errorf("bad core count: %v", cores)
+		}
+		groups = []ProcessorSpec{{Type: "rtc", Count: cores}}
+	}
+	var res []blocks.Processor
+	for _, g := range groups {
+		for i := 0; i < g.Count; i++ {
+			p, err := newProcessor(g)
+			if err != nil {
+				return nil, err
+			}
+			p.SetCtxCost(g.CtxCost)
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// CountProcessors returns the total number of processors in the groups
+func CountProcessors(groups []ProcessorSpec) int {
+	count := 0
+	for _, g := range groups {
+		count += g.Count
+	}
+	return count
+}
+
+// ParsePercentiles parses a comma separated list of percentiles, e.g.
+// "50,99,99.9"
+func ParsePercentiles(s string) ([]float64, error) {
+	var res []float64
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || v <= 0 || v >= 100 {
+			return nil, fmt.Errorf("bad percentile: %q", f)
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// Apply configures a book keeper according to the spec
+func (s StatsSpec) Apply(bk *blocks.BookKeeper) error {
+	if len(s.Percentiles) > 0 {
+		var quantiles []float64
+		for _, p := range s.Percentiles {
+			if p <= 0 || p >= 100 {
+				return fmt.Errorf("bad percentile: %v", p)
+			}
+			quantiles = append(quantiles, p/100)
+		}
+		bk.SetPercentiles(quantiles)
+	}
+	if len(s.Metrics) > 0 {
+		var metrics []blocks.Metric
+		for _, name := range s.Metrics {
+			m, err := blocks.ParseMetric(name)
+			if err != nil {
+				return err
+			}
+			metrics = append(metrics, m)
+		}
+		bk.SetMetrics(metrics...)
+	}
+	switch s.Classes {
+	case "":
+	case "qos":
+		bk.SetClassKey(blocks.ClassByQoS)
+	case "generator":
+		bk.SetClassKey(blocks.ClassByGenerator)
+	case "label":
+		bk.SetClassKey(blocks.ClassByLabel)
+	default:
+		return fmt.Errorf("bad classes: %q", s.Classes)
+	}
+	if s.BatchMeans < 0 || s.BatchMeans == 1 {
+		return fmt.Errorf("bad batch size: %v", s.BatchMeans)
+	}
+	if s.BatchMeans > 0 {
+		bk.SetBatchMeans(s.BatchMeans)
+	}
+	if s.Histogram == "" {
+		return nil
+	}
+	fields := strings.Split(s.Histogram, ":")
+	var vals []float64
+	for _, f := range fields[1:] {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("bad histogram: %q", s.Histogram)
+		}
+		vals = append(vals, v)
+	}
+	switch {
+	case fields[0] == "linear" && len(vals) == 2:
+		bk.SetLinearHistogram(vals[0], int(vals[1]))
+	case fields[0] == "log" && len(vals) == 3 && vals[1] > vals[0]:
+		bk.SetLogHistogram(vals[0], vals[1], vals[2])
+	default:
+		return fmt.Errorf("bad histogram: %q", s.Histogram)
+	}
+	return nil
+}
+
+// BoundSpec is the capacity and drop policy of a queue
+type BoundSpec struct {
+	Capacity     int
+	DropPolicy   string
+	REDThreshold int
+	REDMaxP      float64
+}
+
+// Apply bounds q, sending the dropped requests to drain
+func (s BoundSpec) Apply(sim *engine.Simulation, q engine.QueueInterface, drain blocks.RequestDrain) error {
+	bq, ok := q.(blocks.Bounded)
+	if !ok {
+		return fmt.Errorf("queue cannot be bounded")
+	}
+	if s.Capacity <= 0 {
+		return fmt.Errorf("wrong capacity: %v", s.Capacity)
+	}
+	policy := blocks.TailDrop
+	if s.DropPolicy != "" {
+		var err error
+		if policy, err = blocks.ParseDropPolicy(s.DropPolicy); err != nil {
+			return err
+		}
+	}
+	bq.SetCapacity(s.Capacity, policy)
+	if policy == blocks.RandomEarlyDrop {
+		if s.REDThreshold < 0 || s.REDThreshold >= s.Capacity || s.REDMaxP <= 0 || s.REDMaxP > 1 {
+			return fmt.Errorf("wrong random early drop: threshold %v, max_p %v", s.REDThreshold, s.REDMaxP)
+		}
+		bq.SetRED(sim.NewRand(), s.REDThreshold, s.REDMaxP)
+	}
+	bq.SetDropDrain(drain)
+	return nil
+}
+
+// StopSpec describes the conditions that end a run before its duration.
+// Completed and Precision apply to every stats collector, Generated counts
+// the requests of all the generators together. The run ends when all the
+// given conditions hold. Percentile is given in percent; if it is 0 the
+// precision is that of the mean latency. Zero values are unset.
+type StopSpec struct {
+	Completed  int64   `yaml:"completed"`
+	Generated  int64   `yaml:"generated"`
+	Precision  float64 `yaml:"precision"`
+	Percentile float64 `yaml:"percentile"`
+	BatchSize  int     `yaml:"batch_size"`
+}
+
+// defaultBatchSize is the number of requests per batch when estimating the
+// precision
+const defaultBatchSize = 10000
+
+// IsSet returns true if the spec has any condition
+func (s StopSpec) IsSet() bool {
+	return s.Completed > 0 || s.Generated > 0 || s.Precision > 0
+}
+
+// Apply adds the stop conditions to the stats collectors and generators of
+// the simulation
+func (s StopSpec) Apply(sim *engine.Simulation) error {
+	if s.Completed < 0 || s.Generated < 0 || s.Precision < 0 || s.BatchSize < 0 {
+		return fmt.Errorf("wrong stop conditions: %+v", s)
+	}
+	if s.Percentile < 0 || s.Percentile >= 100 {
+		return fmt.Errorf("wrong stop percentile: %v", s.Percentile)
+	}
+	batchSize := s.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	} else if batchSize == 1 {
+		return fmt.Errorf("wrong batch size: %v", batchSize)
+	}
+	for _, st := range sim.GetStats() {
+		if bk, ok := st.(*blocks.BookKeeper); ok {
+			if s.Completed > 0 {
+				bk.SetStopAfter(s.Completed)
+			}
+			if s.Precision > 0 {
+				bk.SetStopPrecision(s.Precision, s.Percentile/100, batchSize)
+			}
+		}
+	}
+	if s.Generated > 0 {
+		limit := blocks.NewGenerateLimit(sim, s.Generated)
+		for _, a := range sim.GetActors() {
+			if g, ok := a.(blocks.Limited); ok {
+				g.SetGenerateLimit(limit)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,720 @@
+package topologies
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/marioskogias/schedsim/blocks"
+	"github.com/marioskogias/schedsim/engine"
+)
+
+// FileSpec is the description of a topology read from a YAML or JSON file.
+// Queues, generators, processors and stats collectors are referred to by
+// name when wiring them together. Stop may end the run before Duration.
+type FileSpec struct {
+	Duration    float64         `yaml:"duration"`
+	WarmUpTime  float64         `yaml:"warmup_time"`
+	WarmUpCount int64           `yaml:"warmup_count"`
+	Stop        StopSpec        `yaml:"stop"`
+	Stats       []StatsSpec     `yaml:"stats"`
+	Queues      []QueueSpec     `yaml:"queues"`
+	Generators  []GeneratorSpec `yaml:"generators"`
+	Processors  []ProcessorSpec `yaml:"processors"`
+}
+
+// StatsSpec describes a stats collector. Percentiles are given in percent,
+// e.g. 99.9. Histogram is either linear:granularity:buckets or
+// log:min:max:relative_error. Classes is one of qos, generator or label and
+// adds per class statistics. Metrics lists the metrics recorded next to the
+// latency: waiting, service and slowdown. BatchMeans is the number of
+// requests per batch to report batch means confidence intervals. Empty
+// values keep the defaults.
+type StatsSpec struct {
+	Name        string    `yaml:"name"`
+	Percentiles []float64 `yaml:"percentiles"`
+	Histogram   string    `yaml:"histogram"`
+	Classes     string    `yaml:"classes"`
+	Metrics     []string  `yaml:"metrics"`
+	BatchMeans  int       `yaml:"batch_means"`
+}
+
+// QueueSpec describes a queue. Type is fifo (default) or priority. Monitor
+// records the average and maximum length of the queue. Series also records
+// its length every given number of time units, or on every change if it is
+// "change". A positive Capacity bounds the queue, dropping requests
+// according to DropPolicy: tail (default), head or red. Random early drop
+// starts at REDThreshold requests with a probability up to REDMaxP. Dropped
+// requests are counted by the DropDrain stats, the first ones by default.
+type QueueSpec struct {
+	Name         string  `yaml:"name"`
+	Type         string  `yaml:"type"`
+	Monitor      bool    `yaml:"monitor"`
+	Series       string  `yaml:"series"`
+	Capacity     int     `yaml:"capacity"`
+	DropPolicy   string  `yaml:"drop_policy"`
+	REDThreshold int     `yaml:"red_threshold"`
+	REDMaxP      float64 `yaml:"red_max_p"`
+	DropDrain    string  `yaml:"drop_drain"`
+}
+
+// DistSpec describes a random distribution, e.g.
+// {type: exponential, rate: 0.1}. All the keys except type are the
+// distribution parameters:
+//
+//	deterministic   value
+//	exponential     rate
+//	lognormal       mu, sigma
+//	bimodal         v1, v2, ratio
+//	pareto          xm, alpha
+//	bounded_pareto  min, max, alpha
+//	weibull         shape, scale
+//	gamma           shape, scale
+//	erlang          k, rate
+//	hyperexp        p_1, rate_1, ..., p_n, rate_n
+//	coxian          rate_1, p_1, ..., rate_n-1, p_n-1, rate_n
+//	empirical       file, interpolate
+//	discrete        value_1, p_1, ..., value_n, p_n
+//	mixture         mix, a list of distributions with a weight each
+//
+// Hyperexp picks phase i with probability p_i, coxian goes on after phase i
+// with probability p_i. The distributions from pareto to coxian can also be
+// given by mean and scv, the squared coefficient of variation. Bounded Pareto
+// then still needs alpha, and hyperexp has two phases. The empirical
+// distribution is read from a file of samples or CDF points, see
+// blocks.LoadEmpiricalDistr, relative to the topology file. Discrete and
+// mixture weights need not sum to 1, e.g.
+//
+//	{type: mixture, mix: [{type: exponential, rate: 0.5, weight: 0.995},
+//		{type: lognormal, mu: 5, sigma: 1, weight: 0.005}]}
+type DistSpec struct {
+	Type        string             `yaml:"type"`
+	File        string             `yaml:"file"`
+	Interpolate bool               `yaml:"interpolate"`
+	Mix         []DistSpec         `yaml:"mix"`
+	Params      map[string]float64 `yaml:",inline"`
+
+	empirical *blocks.EmpiricalDistr // loaded once by LoadFile
+}
+
+// load reads the file of an empirical distribution, or of the empirical
+// components of a mixture
+func (d *DistSpec) load(dir string) error {
+	for i := range d.Mix {
+		if err := d.Mix[i].load(dir); err != nil {
+			return err
+		}
+	}
+	if d.Type != "empirical" || d.empirical != nil {
+		return nil
+	}
+	if d.File == "" {
+		return fmt.Errorf("distribution %v: missing file", d.Type)
+	}
+	path := d.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	e, err := blocks.LoadEmpiricalDistr(nil, path, d.Interpolate)
+	if err != nil {
+		return err
+	}
+	d.empirical = e
+	return nil
+}
+
+// Empirical returns the empirical distribution loaded by LoadFile, if any
+func (d DistSpec) Empirical() *blocks.EmpiricalDistr {
+	return d.empirical
+}
+
+// GeneratorSpec describes a generator. Type is rr (default), sending
+// requests to the out queues in round robin, rand, or trace. The generated
+// requests carry the generator name, QoS and Label. Trace generators replay
+// the Trace file, relative to the topology file, instead of drawing from
+// Interarrival and Service, see blocks.TraceGenerator. Requests arrive at
+// their recorded times multiplied by TimeScale. Rebase shifts the trace to
+// start with the simulation, Loop replays it for ever.
+type GeneratorSpec struct {
+	Name         string   `yaml:"name"`
+	Type         string   `yaml:"type"`
+	QoS          int      `yaml:"qos"`
+	Label        string   `yaml:"label"`
+	Interarrival DistSpec `yaml:"interarrival"`
+	Service      DistSpec `yaml:"service"`
+	Out          []string `yaml:"out"`
+	Trace        string   `yaml:"trace"`
+	TimeScale    float64  `yaml:"time_scale"`
+	Rebase       bool     `yaml:"rebase"`
+	Loop         bool     `yaml:"loop"`
+
+	trace *blocks.Trace // loaded once by LoadFile
+}
+
+// load reads the trace of a trace generator
+func (g *GeneratorSpec) load(dir string) error {
+	if g.Type != "trace" || g.trace != nil {
+		return nil
+	}
+	if g.Trace == "" {
+		return fmt.Errorf("missing trace")
+	}
+	path := g.Trace
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	t, err := blocks.LoadTrace(path)
+	if err != nil {
+		return err
+	}
+	g.trace = t
+	return nil
+}
+
+// ProcessorSpec describes a group of Count identical processors, one by
+// default. Type is one of rtc, ts, ps, hybrid or qos. Ts processors need a
+// Quantum and hybrid ones a Threshold and an out queue, which the requests
+// still running at the threshold are moved to. In and out queues are given in
+// decreasing priority. QoS processors use Drains, indexed by request QoS,
+// instead of Drain, and need one for every QoS they can read.
+type ProcessorSpec struct {
+	Type      string   `yaml:"type"`
+	Count     int      `yaml:"count"`
+	In        []string `yaml:"in"`
+	Out       []string `yaml:"out"`
+	Drain     string   `yaml:"drain"`
+	Drains    []string `yaml:"drains"`
+	Quantum   float64  `yaml:"quantum"`
+	Threshold float64  `yaml:"threshold"`
+	CtxCost   float64  `yaml:"ctx_cost"`
+}
+
+// LoadFile reads a topology file. JSON files are read as YAML.
+func LoadFile(path string) (*FileSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &FileSpec{}
+	if err := yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	for i := range spec.Generators {
+		g := &spec.Generators[i]
+		if err := g.load(filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("%v: generator %v: %v", path, g.Name, err)
+		}
+		if g.Type == "trace" {
+			continue
+		}
+		for _, d := range []*DistSpec{&g.Interarrival, &g.Service} {
+			if err := d.load(filepath.Dir(path)); err != nil {
+				return nil, fmt.Errorf("%v: generator %v: %v", path, g.Name, err)
+			}
+		}
+	}
+	return spec, nil
+}
+
+func newDistr(sim *engine.Simulation, d DistSpec) (blocks.RandDist, error) {
+	distr, err := buildDistr(sim, d)
+	if err != nil {
+		// not the typed nil of a failed constructor
+		return nil, err
+	}
+	return distr, nil
+}
+
+// buildDistr calls the constructor of the distribution, which checks the
+// parameters
+func buildDistr(sim *engine.Simulation, d DistSpec) (blocks.RandDist, error) {
+	param := func(name string) (float64, error) {
+		v, ok := d.Params[name]
+		if !ok {
+			return 0, fmt.Errorf("distribution %v: missing %v", d.Type, name)
+		}
+		return v, nil
+	}
+	params := func(names ...string) ([]float64, error) {
+		res := make([]float64, len(names))
+		for i, n := range names {
+			v, err := param(n)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = v
+		}
+		return res, nil
+	}
+	// phases returns the values of prefix_1, prefix_2, ... up to the first
+	// missing one
+	phases := func(prefix string) []float64 {
+		var res []float64
+		for i := 1; ; i++ {
+			v, ok := d.Params[fmt.Sprintf("%v_%v", prefix, i)]
+			if !ok {
+				return res
+			}
+			res = append(res, v)
+		}
+	}
+	// fit is true when the distribution is given by mean and scv
+	_, fit := d.Params["mean"]
+	switch d.Type {
+	case "deterministic":
+		v, err := param("value")
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewDeterministicDistrE(v)
+	case "exponential":
+		rate, err := param("rate")
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewExponDistrE(sim.NewRand(), rate)
+	case "lognormal":
+		mu, err := param("mu")
+		if err != nil {
+			return nil, err
+		}
+		sigma, err := param("sigma")
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewLGDistrE(sim.NewRand(), mu, sigma)
+	case "bimodal":
+		v1, err := param("v1")
+		if err != nil {
+			return nil, err
+		}
+		v2, err := param("v2")
+		if err != nil {
+			return nil, err
+		}
+		ratio, err := param("ratio")
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewBiDistrE(sim.NewRand(), v1, v2, ratio)
+	case "pareto":
+		if fit {
+			v, err := params("mean", "scv")
+			if err != nil {
+				return nil, err
+			}
+			return blocks.NewParetoDistrMeanSCVE(sim.NewRand(), v[0], v[1])
+		}
+		v, err := params("xm", "alpha")
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewParetoDistrE(sim.NewRand(), v[0], v[1])
+	case "bounded_pareto":
+		if fit {
+			v, err := params("mean", "scv", "alpha")
+			if err != nil {
+				return nil, err
+			}
+			return blocks.NewBoundedParetoDistrMeanSCVE(sim.NewRand(), v[0], v[1], v[2])
+		}
+		v, err := params("min", "max", "alpha")
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewBoundedParetoDistrE(sim.NewRand(), v[0], v[1], v[2])
+	case "weibull":
+		if fit {
+			v, err := params("mean", "scv")
+			if err != nil {
+				return nil, err
+			}
+			return blocks.NewWeibullDistrMeanSCVE(sim.NewRand(), v[0], v[1])
+		}
+		v, err := params("shape", "scale")
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewWeibullDistrE(sim.NewRand(), v[0], v[1])
+	case "gamma":
+		if fit {
+			v, err := params("mean", "scv")
+			if err != nil {
+				return nil, err
+			}
+			return blocks.NewGammaDistrMeanSCVE(sim.NewRand(), v[0], v[1])
+		}
+		v, err := params("shape", "scale")
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewGammaDistrE(sim.NewRand(), v[0], v[1])
+	case "erlang":
+		if fit {
+			v, err := params("mean", "scv")
+			if err != nil {
+				return nil, err
+			}
+			return blocks.NewErlangDistrMeanSCVE(sim.NewRand(), v[0], v[1])
+		}
+		v, err := params("k", "rate")
+		if err != nil {
+			return nil, err
+		}
+		if k := v[0]; k != math.Trunc(k) || math.Abs(k) > math.MaxInt32 {
+			return nil, fmt.Errorf("wrong erlang k: %v", k)
+		}
+		return blocks.NewErlangDistrE(sim.NewRand(), int(v[0]), v[1])
+	case "hyperexp":
+		if fit {
+			v, err := params("mean", "scv")
+			if err != nil {
+				return nil, err
+			}
+			return blocks.NewH2DistrMeanSCVE(sim.NewRand(), v[0], v[1])
+		}
+		return blocks.NewHyperExpDistrE(sim.NewRand(), phases("p"), phases("rate"))
+	case "coxian":
+		if fit {
+			v, err := params("mean", "scv")
+			if err != nil {
+				return nil, err
+			}
+			return blocks.NewCoxianDistrMeanSCVE(sim.NewRand(), v[0], v[1])
+		}
+		return blocks.NewCoxianDistrE(sim.NewRand(), phases("rate"), phases("p"))
+	case "empirical":
+		if err := d.load("."); err != nil {
+			return nil, err
+		}
+		return d.empirical.WithRand(sim.NewRand()), nil
+	case "discrete":
+		return blocks.NewDiscreteDistrE(sim.NewRand(), phases("value"), phases("p"))
+	case "mixture":
+		if len(d.Mix) == 0 {
+			return nil, fmt.Errorf("distribution %v: missing mix", d.Type)
+		}
+		var weights []float64
+		var components []blocks.RandDist
+		for _, m := range d.Mix {
+			w, ok := m.Params["weight"]
+			if !ok {
+				return nil, fmt.Errorf("distribution %v: missing weight of %v", d.Type, m.Type)
+			}
+			c, err := newDistr(sim, m)
+			if err != nil {
+				return nil, err
+			}
+			weights = append(weights, w)
+			components = append(components, c)
+		}
+		return blocks.NewMixtureDistrE(sim.NewRand(), weights, components)
+	}
+	return nil, fmt.Errorf("unknown distribution: %q", d.Type)
+}
+
+func newGenerator(sim *engine.Simulation, g GeneratorSpec) (engine.ActorInterface, error) {
+	if g.Type == "trace" {
+		if n := g.trace.Queues(); n > len(g.Out) {
+			return nil, fmt.Errorf("trace sends requests to %v out queues, there are %v", n, len(g.Out))
+		}
+		if g.TimeScale < 0 {
+			return nil, fmt.Errorf("wrong time scale: %v", g.TimeScale)
+		}
+		if recs := g.trace.Records; g.Loop && recs[len(recs)-1].Arrival == recs[0].Arrival {
+			return nil, fmt.Errorf("cannot loop a trace without a duration")
+		}
+		tg := blocks.NewTraceGenerator(g.trace)
+		tg.Name, tg.Label = g.Name, g.Label
+		if g.TimeScale != 0 {
+			tg.SetTimeScale(g.TimeScale)
+		}
+		tg.SetRebase(g.Rebase)
+		tg.SetLoop(g.Loop)
+		return tg, nil
+	}
+	wait, err := newDistr(sim, g.Interarrival)
+	if err != nil {
+		return nil, err
+	}
+	service, err := newDistr(sim, g.Service)
+	if err != nil {
+		return nil, err
+	}
+	switch g.Type {
+	case "", "rr":
+		rr := blocks.NewRRGenerator(wait, service)
+		rr.Name, rr.QoS, rr.Label = g.Name, g.QoS, g.Label
+		return rr, nil
+	case "rand":
+		rg := blocks.NewRandGenerator(wait, service)
+		rg.Name, rg.QoS, rg.Label = g.Name, g.QoS, g.Label
+		return rg, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", g.Type)
+}
+
+func newProcessor(p ProcessorSpec) (blocks.Processor, error) {
+	switch p.Type {
+	case "rtc":
+		return &blocks.RTCProcessor{}, nil
+	case "ts":
+		if !(p.Quantum > 0) {
+			return nil, fmt.Errorf("ts processor: wrong quantum: %v", p.Quantum)
+		}
+		return blocks.NewTSProcessor(p.Quantum), nil
+	case "ps":
+		return blocks.NewPSProcessor(), nil
+	case "hybrid":
+		if !(p.Threshold > 0) {
+			return nil, fmt.Errorf("hybrid processor: wrong threshold: %v", p.Threshold)
+		}
+		return blocks.NewHybridProcessor(p.Threshold), nil
+	case "qos":
+		return &blocks.QoSProcessor{}, nil
+	}
+	return nil, fmt.Errorf("unknown processor: %q", p.Type)
+}
+
+// Build creates the blocks described in the file and registers them to the
+// simulation
+func (spec *FileSpec) Build(sim *engine.Simulation) error {
+	stats := map[string]*blocks.BookKeeper{}
+	for _, s := range spec.Stats {
+		if _, ok := stats[s.Name]; ok {
+			return fmt.Errorf("duplicate stats: %v", s.Name)
+		}
+		bk := blocks.NewBookKeeper(sim)
+		bk.SetName(s.Name)
+		if err := s.Apply(bk); err != nil {
+			return fmt.Errorf("stats %v: %v", s.Name, err)
+		}
+		sim.InitStats(bk)
+		stats[s.Name] = bk
+	}
+	getStats := func(name string) (*blocks.BookKeeper, error) {
+		if name == "" && len(spec.Stats) > 0 {
+			name = spec.Stats[0].Name
+		}
+		bk, ok := stats[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown stats: %q", name)
+		}
+		return bk, nil
+	}
+
+	queues := map[string]engine.QueueInterface{}
+	for _, q := range spec.Queues {
+		if _, ok := queues[q.Name]; ok {
+			return fmt.Errorf("duplicate queue: %v", q.Name)
+		}
+		switch q.Type {
+		case "", "fifo":
+			queues[q.Name] = blocks.NewQueue()
+		case "priority":
+			queues[q.Name] = blocks.NewPQueue()
+		default:
+			return fmt.Errorf("queue %v: unknown type %q", q.Name, q.Type)
+		}
+		if q.Capacity > 0 {
+			bk, err := getStats(q.DropDrain)
+			if err != nil {
+				return fmt.Errorf("queue %v: %v", q.Name, err)
+			}
+			bound := BoundSpec{Capacity: q.Capacity, DropPolicy: q.DropPolicy,
+				REDThreshold: q.REDThreshold, REDMaxP: q.REDMaxP}
+			if err := bound.Apply(sim, queues[q.Name], bk.DropDrain()); err != nil {
+				return fmt.Errorf("queue %v: %v", q.Name, err)
+			}
+		} else if q.DropPolicy != "" || q.DropDrain != "" {
+			return fmt.Errorf("queue %v: drop policy without capacity", q.Name)
+		}
+		if q.Monitor || q.Series != "" {
+			m := blocks.NewQueueMonitor(sim, q.Name)
+			if q.Series != "" {
+				interval, err := blocks.ParseSeries(q.Series)
+				if err != nil {
+					return fmt.Errorf("queue %v: %v", q.Name, err)
+				}
+				m.SetSeries(interval)
+			}
+			queues[q.Name].(blocks.Monitored).SetMonitor(m)
+			sim.InitStats(m)
+		}
+	}
+	getQueues := func(names []string) ([]engine.QueueInterface, error) {
+		var res []engine.QueueInterface
+		for _, n := range names {
+			q, ok := queues[n]
+			if !ok {
+				return nil, fmt.Errorf("unknown queue: %q", n)
+			}
+			res = append(res, q)
+		}
+		return res, nil
+	}
+
+	for i, p := range spec.Processors {
+		if len(p.In) == 0 {
+			return fmt.Errorf("processors %v: no in queues", i)
+		}
+		if p.Count < 0 {
+			return fmt.Errorf("processors %v: wrong count: %v", i, p.Count)
+		}
+		if p.Type == "hybrid" && len(p.Out) == 0 {
+			return fmt.Errorf("processors %v: no out queue to move preempted requests to", i)
+		}
+		if p.Type == "qos" && len(p.Drains) == 0 {
+			return fmt.Errorf("processors %v: no drains", i)
+		}
+		in, err := getQueues(p.In)
+		if err != nil {
+			return err
+		}
+		out, err := getQueues(p.Out)
+		if err != nil {
+			return err
+		}
+		var drains []*blocks.BookKeeper
+		if p.Type == "qos" {
+			for _, d := range p.Drains {
+				bk, err := getStats(d)
+				if err != nil {
+					return err
+				}
+				drains = append(drains, bk)
+			}
+		} else {
+			bk, err := getStats(p.Drain)
+			if err != nil {
+				return err
+			}
+			drains = append(drains, bk)
+		}
+		count := p.Count
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			proc, err := newProcessor(p)
+			if err != nil {
+				return err
+			}
+			for _, q := range in {
+				proc.AddInQueue(q)
+			}
+			for _, q := range out {
+				proc.AddOutQueue(q)
+			}
+			for _, d := range drains {
+				proc.SetReqDrain(d)
+			}
+			proc.SetCtxCost(p.CtxCost)
+			sim.RegisterActor(proc)
+		}
+	}
+
+	for i := range spec.Generators {
+		g := &spec.Generators[i]
+		if err := g.load("."); err != nil {
+			return fmt.Errorf("generator %v: %v", g.Name, err)
+		}
+		out, err := getQueues(g.Out)
+		if err != nil {
+			return err
+		}
+		if len(out) == 0 {
+			return fmt.Errorf("generator %v: no out queues", g.Name)
+		}
+		gen, err := newGenerator(sim, *g)
+		if err != nil {
+			return fmt.Errorf("generator %v: %v", g.Name, err)
+		}
+		for _, q := range out {
+			gen.AddOutQueue(q)
+		}
+		sim.RegisterActor(gen)
+	}
+	return spec.checkQoS()
+}
+
+// qos returns the smallest and largest QoS of the requests of a generator
+func (g GeneratorSpec) qos() (int, int) {
+	if g.trace != nil {
+		return g.trace.Classes()
+	}
+	return g.QoS, g.QoS
+}
+
+// qosRange is the smallest and largest QoS of the requests of a queue
+type qosRange struct {
+	min, max int
+}
+
+// checkQoS returns an error if a qos processor can read a request with no
+// drain for its QoS. The requests in a queue come from the generators
+// writing to it and from the queues that hybrid processors forward
+// preempted requests from.
+func (spec *FileSpec) checkQoS() error {
+	ranges := map[string]qosRange{}
+	add := func(q string, min, max int) bool {
+		r, ok := ranges[q]
+		if ok && r.min <= min && r.max >= max {
+			return false
+		}
+		if !ok || min < r.min {
+			r.min = min
+		}
+		if !ok || max > r.max {
+			r.max = max
+		}
+		ranges[q] = r
+		return true
+	}
+	for _, g := range spec.Generators {
+		min, max := g.qos()
+		for _, q := range g.Out {
+			add(q, min, max)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range spec.Processors {
+			if p.Type != "hybrid" {
+				continue
+			}
+			for _, in := range p.In {
+				r, ok := ranges[in]
+				if !ok {
+					continue
+				}
+				for _, out := range p.Out {
+					if add(out, r.min, r.max) {
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	for i, p := range spec.Processors {
+		if p.Type != "qos" {
+			continue
+		}
+		for _, q := range p.In {
+			r, ok := ranges[q]
+			if !ok {
+				continue
+			}
+			if r.min < 0 {
+				return fmt.Errorf("processors %v: queue %v has requests of negative qos %v", i, q, r.min)
+			}
+			if r.max >= len(p.Drains) {
+				return fmt.Errorf("processors %v: no drain for qos %v of queue %v", i, r.max, q)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package topologies
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/marioskogias/schedsim/engine"
+)
+
+// Param is a numeric topology parameter that can be set from the command line
+type Param struct {
+	Name    string
+	Default float64
+	Usage   string
+}
+
+// Params holds the parameter values of a topology by name
+type Params map[string]float64
+
+// Config is what a topology is built with
+type Config struct {
+	Params Params
+	// Processors optionally replaces the homogeneous processors of the
+	// topology with heterogeneous groups defined at runtime
+	Processors []ProcessorSpec
+}
+
+// Topology is a named simulation setup. Build creates the blocks of the
+// topology and registers them to the given simulation, it does not run it.
+type Topology struct {
+	Name        string
+	Description string
+	Params      []Param
+	Build       func(sim *engine.Simulation, cfg Config) error
+}
+
+var registry []*Topology
+
+// Register adds a topology to the registry. Topologies should register
+// themselves from an init function.
+func Register(t *Topology) {
+	for _, r := range registry {
+		if r.Name == t.Name {
+			panic(fmt.Sprintf("topology %v registered twice", t.Name))
+		}
+	}
+	registry = append(registry, t)
+}
+
+// List returns the registered topologies in registration order
+func List() []*Topology {
+	return registry
+}
+
+// Lookup finds a topology by name or by its index in List
+func Lookup(sel string) (*Topology, error) {
+	for _, t := range registry {
+		if t.Name == sel {
+			return t, nil
+		}
+	}
+	if idx, err := strconv.Atoi(sel); err == nil {
+		if idx >= 0 && idx < len(registry) {
+			return registry[idx], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown topology: %v", sel)
+}
+
+// DefaultParams returns the default values of all the topology parameters
+func (t *Topology) DefaultParams() Params {
+	p := Params{}
+	for _, param := range t.Params {
+		p[param.Name] = param.Default
+	}
+	return p
+}
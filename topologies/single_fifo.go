@@ -1,51 +1,72 @@
 package topologies
 
 import (
-	"fmt"
-
 	"github.com/marioskogias/schedsim/blocks"
 	"github.com/marioskogias/schedsim/engine"
 )
 
-func SingleQueue(lambda, mu, duration float64) {
+func init() {
+	Register(&Topology{
+		Name:        "single_queue",
+		Description: "M/M/c: a single FIFO queue shared by run to completion, time sharing or hybrid cores",
+		Params: []Param{
+			{"cores", defaultCores, "number of processors"},
+			{"mu", 0.02, "mu service rate"}, // default 50usec
+			{"lambda", 0.005, "lambda poisson interarrival"},
+			{"quantum", 0, "time sharing quantum of the processors, 0 runs them to completion"},
+			{"threshold", 0, "hybrid threshold of the processors, 0 runs them to completion"},
+		},
+		Build: func(sim *engine.Simulation, cfg Config) error {
+			p := cfg.Params
+			groups := cfg.Processors
+			if len(groups) == 0 {
+				var err error
+				if groups, err = coreGroups(p); err != nil {
+					return err
+				}
+			}
+			return SingleQueue(sim, p["lambda"], p["mu"], int(p["cores"]), groups)
+		},
+	})
+}
 
-	engine.InitSim()
+// SingleQueue builds a single queue served by cores run to completion
+// processors, or by the given processor groups if any
+func SingleQueue(sim *engine.Simulation, lambda, mu float64, cores int, groups []ProcessorSpec) error {
 
 	//Init the statistics
-	stats := blocks.NewBookKeeper()
+	stats := blocks.NewBookKeeper(sim)
 	stats.SetName("Main Stats")
-	engine.InitStats(stats)
+	sim.InitStats(stats)
 
 	// Add generator
-	g := blocks.NewMMGenerator(lambda, mu)
+	g := blocks.NewMMGenerator(sim, lambda, mu)
 
 	// Create queues
 	q := blocks.NewQueue()
 
 	// Create processors
-	processors := make([]blocks.Processor, cores)
-
-	// first the slow cores
-	for i := 0; i < cores; i++ {
-		processors[i] = &blocks.RTCProcessor{}
+	processors, err := newProcessors(groups, cores)
+	if err != nil {
+		return err
 	}
 
 	// Connect the queue
 	g.AddOutQueue(q)
 
-	for i := 0; i < cores; i++ {
-		processors[i].AddInQueue(q)
+	for _, p := range processors {
+		p.AddInQueue(q)
+		// hybrid processors put preempted requests back in the queue
+		p.AddOutQueue(q)
 	}
 
 	// Add the stats and register processors
 	for _, p := range processors {
 		p.SetReqDrain(stats)
-		engine.RegisterActor(p)
+		sim.RegisterActor(p)
 	}
 
 	// Register the generator
-	engine.RegisterActor(g)
-
-	fmt.Printf("Cores:%v\tservice_rate:%v\tinterarrival_rate:%v\n", cores, mu, lambda)
-	engine.Run(duration)
+	sim.RegisterActor(g)
+	return nil
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/marioskogias/schedsim/engine"
+	"github.com/marioskogias/schedsim/validate"
+)
+
+// validateCases implements `schedsim validate [flags]`. It simulates the
+// validation cases and compares them with their analytical results. It
+// exits with an error if any check is off by more than the tolerance.
+func validateCases(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	var name = fs.String("case", "", "only run the named case")
+	var list = fs.Bool("list", false, "list the cases and exit")
+	var requests = fs.Int64("requests", 1000000, "recorded requests per case")
+	var seed = fs.Int64("seed", 0, "random seed (0 picks one from the current time)")
+	var tolerance = fs.Float64("tolerance", 0.05, "largest relative error of a check")
+	var coreName = addCoreFlag(fs)
+	fs.Parse(args)
+
+	core, err := engine.ParseCore(*coreName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cases := validate.Cases()
+	if *list {
+		for _, c := range cases {
+			fmt.Printf("%v\t%v\n", c.Name, c.Description)
+		}
+		return
+	}
+	if *name != "" {
+		c, err := validate.Lookup(*name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cases = []validate.Case{c}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UTC().UnixNano()
+	}
+
+	fmt.Printf("seed:%v\ttolerance:%v\tengine:%v\n", *seed, *tolerance, core)
+	fmt.Printf("Case\tCheck\tExpected\tSimulated\tRelErr\tResult\n")
+	failed := false
+	for _, c := range cases {
+		r := validate.Run(c, core, *seed, *requests)
+		for _, ch := range r.Checks {
+			result := "ok"
+			if !(ch.RelErr() <= *tolerance) {
+				result = "FAIL"
+				failed = true
+			}
+			fmt.Printf("%v\t%v\t%v\t%v\t%v\t%v\n", c.Name, ch.Name, ch.Expected, ch.Simulated, ch.RelErr(), result)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+package validate
+
+import (
+	"math"
+)
+
+// ErlangC returns the probability that an arrival waits in an M/M/c queue
+// with offered load a = lambda/mu
+func ErlangC(c int, a float64) float64 {
+	// Erlang B by recursion, then C from B
+	b := 1.0
+	for k := 1; k <= c; k++ {
+		b = a * b / (float64(k) + a*b)
+	}
+	rho := a / float64(c)
+	return b / (1 - rho*(1-b))
+}
+
+// MMcMean returns the mean sojourn time of an M/M/c FCFS queue
+func MMcMean(lambda, mu float64, c int) float64 {
+	return ErlangC(c, lambda/mu)/(float64(c)*mu-lambda) + 1/mu
+}
+
+// mmcSojournCCDF returns P(T > t) for the sojourn time of an M/M/c FCFS
+// queue. The waiting time is 0 with probability 1-C and exponential with
+// rate c*mu-lambda otherwise, the service exponential with rate mu.
+func mmcSojournCCDF(lambda, mu float64, c int, t float64) float64 {
+	pw := ErlangC(c, lambda/mu)
+	delta := float64(c)*mu - lambda
+	if math.Abs(delta-mu) < 1e-12*mu {
+		return math.Exp(-mu*t) * (1 + pw*mu*t)
+	}
+	return math.Exp(-mu*t) + pw*mu/(delta-mu)*(math.Exp(-mu*t)-math.Exp(-delta*t))
+}
+
+// MMcQuantile returns the quantile q of the sojourn time of an M/M/c FCFS
+// queue
+func MMcQuantile(lambda, mu float64, c int, q float64) float64 {
+	ccdf := func(t float64) float64 { return mmcSojournCCDF(lambda, mu, c, t) }
+	hi := 1 / mu
+	for ccdf(hi) > 1-q {
+		hi *= 2
+	}
+	lo := 0.0
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if ccdf(mid) > 1-q {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// MG1Mean returns the mean sojourn time of an M/G/1 FCFS queue with service
+// time moments es = E[S] and es2 = E[S^2] (Pollaczek-Khinchine)
+func MG1Mean(lambda, es, es2 float64) float64 {
+	rho := lambda * es
+	return lambda*es2/(2*(1-rho)) + es
+}
+
+// MM1PSSlowdown returns the mean slowdown of an M/G/1 processor sharing
+// queue, which is the same for every service time distribution
+func MM1PSSlowdown(lambda, es float64) float64 {
+	return 1 / (1 - lambda*es)
+}
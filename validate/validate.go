@@ -0,0 +1,252 @@
+// Package validate compares simulated queues against the results of
+// queueing theory. Every Case builds a canonical topology and knows its
+// analytical mean latency and, where known in closed form, percentiles. It
+// is meant to be run after changes to the engine or the blocks, either with
+// `schedsim validate` or with go test, which runs all the cases on both
+// engine cores, with fewer requests in short mode.
+package validate
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/marioskogias/schedsim/blocks"
+	"github.com/marioskogias/schedsim/engine"
+)
+
+// Case is a topology with known analytical results. Build connects a
+// generator, queues and processors draining to bk. Mean is the mean
+// latency, Percentiles maps quantiles to latencies and Slowdown is the mean
+// slowdown, if known.
+type Case struct {
+	Name        string
+	Description string
+	Build       func(sim *engine.Simulation, bk *blocks.BookKeeper)
+	Mean        float64
+	Percentiles map[float64]float64
+	Slowdown    float64
+}
+
+// Check compares a simulated value with its analytical one
+type Check struct {
+	Name      string  `json:"name"`
+	Expected  float64 `json:"expected"`
+	Simulated float64 `json:"simulated"`
+}
+
+// RelErr returns the relative error of the simulated value
+func (c Check) RelErr() float64 {
+	return math.Abs(c.Simulated-c.Expected) / c.Expected
+}
+
+// Report is the outcome of simulating a Case
+type Report struct {
+	Case   string  `json:"case"`
+	Count  int64   `json:"count"`
+	Checks []Check `json:"checks"`
+}
+
+// Failed returns the checks with a relative error above tolerance
+func (r Report) Failed(tolerance float64) []Check {
+	var res []Check
+	for _, c := range r.Checks {
+		if !(c.RelErr() <= tolerance) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// Err returns an error describing the failed checks, or nil if all of them
+// are within tolerance
+func (r Report) Err(tolerance float64) error {
+	failed := r.Failed(tolerance)
+	if len(failed) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, c := range failed {
+		msgs = append(msgs, fmt.Sprintf("%v: expected %v, simulated %v (%.1f%% off)",
+			c.Name, c.Expected, c.Simulated, 100*c.RelErr()))
+	}
+	return fmt.Errorf("%v: %v", r.Case, strings.Join(msgs, ", "))
+}
+
+// Run simulates a case with the given engine core until requests requests
+// are recorded, after a warm-up of another tenth as many requests.
+func Run(c Case, core engine.Core, seed int64, requests int64) Report {
+	sim := engine.NewSimulation(seed)
+	sim.SetCore(core)
+	bk := blocks.NewBookKeeper(sim)
+	bk.SetName(c.Name)
+	bk.SetLogHistogram(0.01, 1e9, 0.001)
+	var quantiles []float64
+	for q := range c.Percentiles {
+		quantiles = append(quantiles, q)
+	}
+	if len(quantiles) > 0 {
+		bk.SetPercentiles(quantiles)
+	}
+	if c.Slowdown > 0 {
+		bk.SetMetrics(blocks.Slowdown)
+	}
+	bk.SetWarmUp(0, requests/10)
+	bk.SetStopAfter(requests)
+	sim.InitStats(bk)
+	c.Build(sim, bk)
+	sim.Run(math.MaxFloat64)
+
+	res := bk.GetResult()
+	r := Report{Case: c.Name, Count: res.Count}
+	r.Checks = append(r.Checks, Check{"avg", c.Mean, res.Avg})
+	for _, p := range res.Percentiles {
+		if want, ok := c.Percentiles[p.Q]; ok {
+			r.Checks = append(r.Checks, Check{"p" + blocks.PercentileLabel(p.Q), want, p.V})
+		}
+	}
+	if c.Slowdown > 0 {
+		r.Checks = append(r.Checks, Check{"slowdown", c.Slowdown, res.Metrics[0].Avg})
+	}
+	return r
+}
+
+// singleQueue builds a generator feeding a FIFO queue served by the given
+// processors
+func singleQueue(newGen func(sim *engine.Simulation) engine.ActorInterface, newProc func() blocks.Processor, cores int) func(sim *engine.Simulation, bk *blocks.BookKeeper) {
+	return func(sim *engine.Simulation, bk *blocks.BookKeeper) {
+		q := blocks.NewQueue()
+		for i := 0; i < cores; i++ {
+			p := newProc()
+			p.AddInQueue(q)
+			p.SetReqDrain(bk)
+			sim.RegisterActor(p)
+		}
+		g := newGen(sim)
+		g.AddOutQueue(q)
+		sim.RegisterActor(g)
+	}
+}
+
+// queuePair builds two generators feeding a queue each. Every processor
+// has its own queue as the first input and the other one as the second.
+func queuePair(newGen func(sim *engine.Simulation) engine.ActorInterface, newProc func() blocks.Processor) func(sim *engine.Simulation, bk *blocks.BookKeeper) {
+	return func(sim *engine.Simulation, bk *blocks.BookKeeper) {
+		qs := []engine.QueueInterface{blocks.NewQueue(), blocks.NewQueue()}
+		for i := range qs {
+			p := newProc()
+			p.AddInQueue(qs[i])
+			p.AddInQueue(qs[1-i])
+			p.SetReqDrain(bk)
+			sim.RegisterActor(p)
+		}
+		for _, q := range qs {
+			g := newGen(sim)
+			g.AddOutQueue(q)
+			sim.RegisterActor(g)
+		}
+	}
+}
+
+func rtc() blocks.Processor {
+	return &blocks.RTCProcessor{}
+}
+
+func ps() blocks.Processor {
+	return blocks.NewPSProcessor()
+}
+
+func mm(lambda, mu float64) func(sim *engine.Simulation) engine.ActorInterface {
+	return func(sim *engine.Simulation) engine.ActorInterface {
+		return blocks.NewMMGenerator(sim, lambda, mu)
+	}
+}
+
+func mmcPercentiles(lambda, mu float64, c int) map[float64]float64 {
+	res := map[float64]float64{}
+	for _, q := range blocks.DefaultPercentiles {
+		res[q] = MMcQuantile(lambda, mu, c, q)
+	}
+	return res
+}
+
+// Cases returns the validation cases. Service times have a mean of 50 time
+// units.
+func Cases() []Case {
+	const mu = 0.02
+	const es = 1 / mu
+
+	// lognormal with a mean of 50 and sigma 1
+	const sigma = 1.0
+	lnMu := math.Log(es) - sigma*sigma/2
+	lnEs2 := math.Exp(2*lnMu + 2*sigma*sigma)
+
+	// bimodal: 90% of 10 and 10% of 410
+	const v1, v2, ratio = 10.0, 410.0, 0.9
+	biEs2 := ratio*v1*v1 + (1-ratio)*v2*v2
+
+	return []Case{
+		{
+			Name:        "mm1",
+			Description: "M/M/1 at rho=0.7",
+			Build:       singleQueue(mm(0.014, mu), rtc, 1),
+			Mean:        MMcMean(0.014, mu, 1),
+			Percentiles: mmcPercentiles(0.014, mu, 1),
+		},
+		{
+			Name:        "mmc",
+			Description: "M/M/8 at rho=0.875 (Erlang C)",
+			Build:       singleQueue(mm(0.14, mu), rtc, 8),
+			Mean:        MMcMean(0.14, mu, 8),
+			Percentiles: mmcPercentiles(0.14, mu, 8),
+		},
+		{
+			Name:        "md1",
+			Description: "M/D/1 at rho=0.7",
+			Build: singleQueue(func(sim *engine.Simulation) engine.ActorInterface {
+				return blocks.NewMDGenerator(sim, 0.014, es)
+			}, rtc, 1),
+			Mean: MG1Mean(0.014, es, es*es),
+		},
+		{
+			Name:        "mg1-lognormal",
+			Description: "M/G/1 with lognormal service times (sigma=1) at rho=0.7",
+			Build: singleQueue(func(sim *engine.Simulation) engine.ActorInterface {
+				return blocks.NewMLNGenerator(sim, 0.014, lnMu, sigma)
+			}, rtc, 1),
+			Mean: MG1Mean(0.014, es, lnEs2),
+		},
+		{
+			Name:        "mg1-bimodal",
+			Description: "M/G/1 with bimodal service times (90% 10, 10% 410) at rho=0.5",
+			Build: singleQueue(func(sim *engine.Simulation) engine.ActorInterface {
+				return blocks.NewDBGenerator(sim, 0.01, v1, v2, ratio)
+			}, rtc, 1),
+			Mean: MG1Mean(0.01, es, biEs2),
+		},
+		{
+			Name:        "mm1-pair",
+			Description: "two M/M/1 queues at rho=0.3, each processor only reading the first of its two in queues",
+			Build:       queuePair(mm(0.006, mu), rtc),
+			Mean:        MMcMean(0.006, mu, 1),
+			Percentiles: mmcPercentiles(0.006, mu, 1),
+		},
+		{
+			Name:        "mm1-ps",
+			Description: "M/M/1 processor sharing at rho=0.7",
+			Build:       singleQueue(mm(0.014, mu), ps, 1),
+			Mean:        MMcMean(0.014, mu, 1),
+			Slowdown:    MM1PSSlowdown(0.014, es),
+		},
+	}
+}
+
+// Lookup returns the case with the given name
+func Lookup(name string) (Case, error) {
+	for _, c := range Cases() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return Case{}, fmt.Errorf("unknown case: %q", name)
+}
@@ -0,0 +1,25 @@
+package validate_test
+
+import (
+	"testing"
+
+	"github.com/marioskogias/schedsim/engine"
+	"github.com/marioskogias/schedsim/validate"
+)
+
+func TestCases(t *testing.T) {
+	requests, tolerance := int64(1000000), 0.05
+	if testing.Short() {
+		requests, tolerance = 100000, 0.1
+	}
+	for _, core := range []engine.Core{engine.GoroutineCore, engine.CoroutineCore} {
+		for _, c := range validate.Cases() {
+			t.Run(core.String()+"/"+c.Name, func(t *testing.T) {
+				t.Parallel()
+				if err := validate.Run(c, core, 1, requests).Err(tolerance); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}